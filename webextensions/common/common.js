@@ -305,9 +305,14 @@ export async function sendToHost(message) {
   try {
     message.logging = message.logging && configs.debug;
     message.debug = message.debug && configs.debug;
+    message.returnLogs = configs.debug;
     const response = await browser.runtime.sendNativeMessage(Constants.HOST_ID, message);
     if (!response || typeof response != 'object')
       throw new Error(`invalid response: ${String(response)}`);
+    if (response.logs) {
+      log(`Logs of the host for ${message.command}:`, response.logs);
+      delete response.logs;
+    }
     return response;
   }
   catch(error) {
@@ -446,15 +451,21 @@ export async function applyOutlookGPOConfigs() {
   if (!response)
     return;
 
-  applyOutlookGPOConfig(response, 'countdownAllowSkip');
-  applyOutlookGPOConfig(response, 'showCountdown');
-  applyOutlookGPOConfig(response, 'countdownSeconds');
-  applyOutlookGPOConfig(response, 'skipConfirmationForInternalMail');
-  applyOutlookGPOConfig(response, 'confirmMultipleRecipientDomains');
-  applyOutlookGPOConfig(response, 'minConfirmMultipleRecipientDomainsCount');
-  applyOutlookGPOConfig(response, 'fixedInternalDomains');
-  applyOutlookGPOConfigRuleItems(response, 'builtInAttentionDomains');
-  applyOutlookGPOConfigRuleItems(response, 'builtInAttentionTerms');
+  const remoteKeys = new Set([
+    ...Object.keys(response.Default || {}),
+    ...Object.keys(response.Locked || {}),
+  ]);
+  for (const remoteKey of remoteKeys) {
+    const matched = remoteKey.match(/^Has(.+)$/);
+    if (!matched)
+      continue;
+    const key = `${matched[1].charAt(0).toLowerCase()}${matched[1].slice(1)}`;
+    const ruleMatched = key.match(/^(builtIn.+)Items$/);
+    if (ruleMatched)
+      applyOutlookGPOConfigRuleItems(response, ruleMatched[1]);
+    else
+      applyOutlookGPOConfig(response, key);
+  }
 }
 
 export function applyExtraStyleRules() {
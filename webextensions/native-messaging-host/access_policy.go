@@ -0,0 +1,225 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const ACCESS_POLICY_FILE_NAME = "access-policy.json"
+
+// Administrator controlled allowlist for the host. Without any policy
+// everything readable is allowed, for backward compatibility. Each kind of
+// restriction is applied only when it is given: local files must be in one
+// of Directories or match one of Patterns, and must have one of Extensions.
+// URLs must start with one of URLPrefixes. Callers must be one of
+// CallerIDs, or one of DEFAULT_ALLOWED_CALLER_IDS if it is empty.
+type AccessPolicy struct {
+	Directories []string `json:"directories"`
+	Patterns    []string `json:"patterns"`
+	Extensions  []string `json:"extensions"`
+	URLPrefixes []string `json:"urlPrefixes"`
+	CallerIDs   []string `json:"callerIds"`
+	DenyAll     bool     `json:"-"`
+}
+
+var accessPolicyLoaded = false
+var CurrentAccessPolicy *AccessPolicy
+
+func GetAccessPolicy() *AccessPolicy {
+	if accessPolicyLoaded {
+		return CurrentAccessPolicy
+	}
+	accessPolicyLoaded = true
+	policy, err := ReadAccessPolicy()
+	if err != nil {
+		// A broken policy must not allow everything.
+		LogForWarn("Failed to read access policy, deny all: " + err.Error())
+		policy = &AccessPolicy{DenyAll: true}
+	}
+	CurrentAccessPolicy = policy
+	return CurrentAccessPolicy
+}
+
+// Returns nil if there is no policy file.
+func ReadAccessPolicyFile(path string) (*AccessPolicy, error) {
+	LogForDebug("Read access policy from " + path)
+	buffer, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	policy := &AccessPolicy{}
+	if err := json.Unmarshal(buffer, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func GetAccessPolicyFilePath() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(executable), ACCESS_POLICY_FILE_NAME), nil
+}
+
+func NormalizePathForComparison(path string) string {
+	path = filepath.Clean(path)
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+func ExpandPolicyPath(path string) string {
+	if expanded, err := ExpandParentProcessDir(path); err == nil {
+		path = expanded
+	}
+	return ExpandAllEnvVars(path)
+}
+
+func (policy *AccessPolicy) AllowsFile(path string) bool {
+	if policy.DenyAll {
+		return false
+	}
+	path = NormalizePathForComparison(path)
+
+	if len(policy.Extensions) > 0 {
+		extension := strings.ToLower(filepath.Ext(path))
+		allowed := false
+		for _, allowedExtension := range policy.Extensions {
+			allowedExtension = strings.ToLower(allowedExtension)
+			if !strings.HasPrefix(allowedExtension, ".") {
+				allowedExtension = "." + allowedExtension
+			}
+			if extension == allowedExtension {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if len(policy.Directories) == 0 && len(policy.Patterns) == 0 {
+		return true
+	}
+
+	for _, directory := range policy.Directories {
+		directory = NormalizePathForComparison(ExpandPolicyPath(directory))
+		relative, err := filepath.Rel(directory, path)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	for _, pattern := range policy.Patterns {
+		pattern = ExpandPolicyPath(pattern)
+		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+			pattern = strings.ToLower(pattern)
+		}
+		if matched, err := filepath.Match(filepath.Clean(pattern), path); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *AccessPolicy) AllowsURL(rawURL string) bool {
+	if policy.DenyAll {
+		return false
+	}
+	if len(policy.URLPrefixes) == 0 {
+		return true
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range policy.URLPrefixes {
+		if URLHasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// The scheme and the host must be same, and the path must be same or under
+// the path of the prefix. So "https://example.com/lists" doesn't allow
+// "https://example.com.evil.com/" or "https://example.com/lists-secret".
+func URLHasPrefix(target *url.URL, rawPrefix string) bool {
+	prefix, err := url.Parse(rawPrefix)
+	if err != nil || prefix.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(target.Scheme, prefix.Scheme) ||
+		!strings.EqualFold(target.Hostname(), prefix.Hostname()) ||
+		GetURLPort(target) != GetURLPort(prefix) {
+		return false
+	}
+	prefixPath := strings.TrimSuffix(prefix.Path, "/")
+	if prefixPath == "" {
+		return true
+	}
+	targetPath := path.Clean("/" + target.Path)
+	return targetPath == prefixPath || strings.HasPrefix(targetPath, prefixPath+"/")
+}
+
+func GetURLPort(target *url.URL) string {
+	if port := target.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(target.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+func CheckFileAccess(originalPath string, path string) *HostError {
+	policy := GetAccessPolicy()
+	if policy == nil || policy.AllowsFile(path) {
+		return nil
+	}
+	LogForWarn("Access denied by the policy: " + path)
+	return &HostError{
+		Code:    ERROR_CODE_ACCESS_DENIED,
+		Message: "access denied by the policy",
+		Path:    originalPath,
+	}
+}
+
+func CheckURLAccess(url string) *HostError {
+	policy := GetAccessPolicy()
+	if policy == nil || policy.AllowsURL(url) {
+		return nil
+	}
+	LogForWarn("Access denied by the policy: " + url)
+	return &HostError{
+		Code:    ERROR_CODE_ACCESS_DENIED,
+		Message: "access denied by the policy",
+		Path:    url,
+	}
+}
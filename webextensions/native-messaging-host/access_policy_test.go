@@ -0,0 +1,108 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func UseAccessPolicy(t *testing.T, policy *AccessPolicy) {
+	t.Helper()
+	accessPolicyLoaded = true
+	CurrentAccessPolicy = policy
+	t.Cleanup(func() {
+		accessPolicyLoaded = false
+		CurrentAccessPolicy = nil
+	})
+}
+
+func TestAccessPolicy_AllowsFile(t *testing.T) {
+	listsDir := t.TempDir()
+	otherDir := t.TempDir()
+	os.Setenv("TEST_LISTS_DIR", listsDir)
+	defer os.Unsetenv("TEST_LISTS_DIR")
+
+	policy := &AccessPolicy{
+		Directories: []string{"${TEST_LISTS_DIR}"},
+		Patterns:    []string{filepath.Join(otherDir, "allowed-*.txt")},
+		Extensions:  []string{"txt", ".csv"},
+	}
+	cases := []struct {
+		path    string
+		allowed bool
+	}{
+		{filepath.Join(listsDir, "domains.txt"), true},
+		{filepath.Join(listsDir, "sub", "terms.CSV"), true},
+		{filepath.Join(listsDir, "id_rsa"), false},
+		{filepath.Join(listsDir, "..", "domains.txt"), false},
+		{filepath.Join(otherDir, "allowed-domains.txt"), true},
+		{filepath.Join(otherDir, "domains.txt"), false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.allowed, policy.AllowsFile(c.path), c.path)
+	}
+}
+
+func TestAccessPolicy_AllowsURL(t *testing.T) {
+	policy := &AccessPolicy{URLPrefixes: []string{"https://intranet.example.com/lists/"}}
+	assert.True(t, policy.AllowsURL("https://intranet.example.com/lists/domains.txt"))
+	assert.True(t, policy.AllowsURL("HTTPS://intranet.example.com/lists/domains.txt"))
+	assert.False(t, policy.AllowsURL("https://intranet.example.com/secret.txt"))
+	assert.False(t, policy.AllowsURL("https://intranet.example.com/lists/../secret.txt"))
+	assert.False(t, policy.AllowsURL("http://intranet.example.com/lists/domains.txt"))
+	assert.False(t, policy.AllowsURL("https://intranet.example.com@evil.example.com/lists/domains.txt"))
+}
+
+func TestAccessPolicy_AllowsURL_HostSuffix(t *testing.T) {
+	policy := &AccessPolicy{URLPrefixes: []string{"https://intranet.example.com"}}
+	assert.True(t, policy.AllowsURL("https://intranet.example.com/lists/domains.txt"))
+	assert.True(t, policy.AllowsURL("https://INTRANET.example.com:443/domains.txt"))
+	assert.False(t, policy.AllowsURL("https://intranet.example.com.evil.com/"))
+	assert.False(t, policy.AllowsURL("https://intranet.example.com:8443/domains.txt"))
+}
+
+func TestAccessPolicy_AllowsURL_MissingTrailingSlash(t *testing.T) {
+	policy := &AccessPolicy{URLPrefixes: []string{"https://intranet.example.com/lists"}}
+	assert.True(t, policy.AllowsURL("https://intranet.example.com/lists"))
+	assert.True(t, policy.AllowsURL("https://intranet.example.com/lists/domains.txt"))
+	assert.False(t, policy.AllowsURL("https://intranet.example.com/lists-secret/domains.txt"))
+}
+
+func TestFetch_DeniedByAccessPolicy(t *testing.T) {
+	allowedDir := t.TempDir()
+	deniedDir := t.TempDir()
+	UseAccessPolicy(t, &AccessPolicy{Directories: []string{allowedDir}})
+
+	allowedPath := CreateTempFileToFetch(t, allowedDir, "domains.txt", "example.com")
+	contents, err := Fetch(allowedPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", contents)
+
+	deniedPath := CreateTempFileToFetch(t, deniedDir, "secret.txt", "secret")
+	contents, err = Fetch(deniedPath)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_ACCESS_DENIED, err.Code)
+		assert.Equal(t, deniedPath, err.Path)
+	}
+	assert.Equal(t, "", contents)
+}
+
+func TestReadAccessPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	policy, err := ReadAccessPolicyFile(filepath.Join(dir, ACCESS_POLICY_FILE_NAME))
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	path := CreateTempFileToFetch(t, dir, ACCESS_POLICY_FILE_NAME, `{"directories":["/srv/lists"],"extensions":["txt"]}`)
+	policy, err = ReadAccessPolicyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &AccessPolicy{Directories: []string{"/srv/lists"}, Extensions: []string{"txt"}}, policy)
+}
@@ -0,0 +1,43 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+// Same to "allowed_extensions" in the manifest files.
+var DEFAULT_ALLOWED_CALLER_IDS = []string{
+	"flexible-confirm-mail@clear-code.com",
+	"flexible-confirm-mail-progressive@clear-code.com",
+}
+
+func GetAllowedCallerIDs() []string {
+	policy := GetAccessPolicy()
+	if policy != nil && len(policy.CallerIDs) > 0 {
+		return policy.CallerIDs
+	}
+	return DEFAULT_ALLOWED_CALLER_IDS
+}
+
+// Thunderbird gives the ID of the calling add-on as a command line argument.
+// An empty ID means that the host is started without Thunderbird, and it is
+// allowed.
+func CheckCaller(callerID string) *HostError {
+	if callerID == "" {
+		return nil
+	}
+	policy := GetAccessPolicy()
+	if policy == nil || !policy.DenyAll {
+		for _, allowedID := range GetAllowedCallerIDs() {
+			if callerID == allowedID {
+				return nil
+			}
+		}
+	}
+	LogForWarn("Caller is not allowed: " + callerID)
+	return &HostError{
+		Code:    ERROR_CODE_CALLER_NOT_ALLOWED,
+		Message: "caller is not allowed: " + callerID,
+	}
+}
@@ -0,0 +1,76 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"runtime"
+)
+
+// Increment this when the format of requests or responses is changed
+// incompatibly, or a new feature which the add-on must know is introduced.
+const PROTOCOL_VERSION = 1
+
+// Features available on all platforms.
+var CommonFeatures = map[string]bool{
+	"persistentConnection": true,
+	"chunkedResponse":      true,
+	"httpFetch":            true,
+	"encodingConversion":   true,
+	"accessPolicy":         true,
+}
+
+type CommandCapability struct {
+	Name   string         `json:"name"`
+	Help   string         `json:"help"`
+	Params []CommandParam `json:"params"`
+}
+
+type CapabilitiesResponse struct {
+	ResponseMeta
+	Version         string              `json:"version"`
+	ProtocolVersion int                 `json:"protocolVersion"`
+	OS              string              `json:"os"`
+	Arch            string              `json:"arch"`
+	CallerID        string              `json:"callerId"`
+	Commands        []CommandCapability `json:"commands"`
+	Features        map[string]bool     `json:"features"`
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:    "capabilities",
+		Help:    "report version of the host and supported commands and features",
+		Handler: HandleCapabilities,
+	})
+}
+
+func HandleCapabilities(request *Request) (Response, error) {
+	response := &CapabilitiesResponse{
+		Version:         VERSION,
+		ProtocolVersion: PROTOCOL_VERSION,
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		CallerID:        request.CallerID,
+		Commands:        []CommandCapability{},
+		Features:        map[string]bool{},
+	}
+	for _, name := range CommandNames() {
+		command := Commands[name]
+		params := command.Params
+		if params == nil {
+			params = []CommandParam{}
+		}
+		response.Commands = append(response.Commands, CommandCapability{name, command.Help, params})
+	}
+	for feature, supported := range CommonFeatures {
+		response.Features[feature] = supported
+	}
+	for feature, supported := range PlatformFeatures {
+		response.Features[feature] = supported
+	}
+	return response, nil
+}
@@ -0,0 +1,90 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/lhside/chrome-go"
+	"io"
+	"unicode/utf8"
+)
+
+// Each chunk is embedded as a JSON string, so its size can be doubled by
+// escaping of quotations and backslashes. This must be small enough to
+// keep each message under MAX_RESPONSE_SIZE.
+const CHUNK_SIZE = 256 * 1024
+
+type Chunk struct {
+	Index    int    `json:"index"`
+	Total    int    `json:"total"`
+	Checksum string `json:"checksum"` // SHA-256 of the whole body
+	Data     string `json:"data"`
+}
+
+type ChunkResponse struct {
+	ResponseMeta
+	Chunk Chunk `json:"chunk"`
+}
+
+// Splits the body at boundaries of UTF-8 characters, to keep each chunk
+// a valid string.
+func SplitIntoChunks(body []byte, size int) []string {
+	chunks := []string{}
+	for len(body) > 0 {
+		end := size
+		if end >= len(body) {
+			end = len(body)
+		} else {
+			for end > 0 && !utf8.RuneStart(body[end]) {
+				end--
+			}
+			if end == 0 {
+				end = size
+			}
+		}
+		chunks = append(chunks, string(body[:end]))
+		body = body[end:]
+	}
+	return chunks
+}
+
+// Posts a serialized response as multiple messages. The add-on must
+// concatenate data of all chunks in the order of their index, verify the
+// checksum, and parse the result as a JSON.
+func PostChunkedResponse(id json.RawMessage, body []byte, output io.Writer) error {
+	sum := sha256.Sum256(body)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	chunks := SplitIntoChunks(body, CHUNK_SIZE)
+	LogForDebug("Sending response in " + fmt.Sprint(len(chunks)) + " chunks")
+	for index, data := range chunks {
+		response := &ChunkResponse{
+			Chunk: Chunk{
+				Index:    index,
+				Total:    len(chunks),
+				Checksum: checksum,
+				Data:     data,
+			},
+		}
+		response.ID = id
+
+		var message bytes.Buffer
+		encoder := json.NewEncoder(&message)
+		// "<", ">" and "&" would be expanded to 6 bytes each
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+		if err := chrome.Post(bytes.TrimRight(message.Bytes(), "\n"), output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type CommandParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // "string", "boolean", "number", "array" or "object"
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+type CommandHandler func(request *Request) (Response, error)
+
+type Command struct {
+	Name    string
+	Params  []CommandParam
+	Help    string
+	Example string // example of params for the -p option
+	Handler CommandHandler
+}
+
+var Commands = map[string]*Command{}
+
+func RegisterCommand(command *Command) {
+	if _, exists := Commands[command.Name]; exists {
+		panic("duplicated command: " + command.Name)
+	}
+	Commands[command.Name] = command
+}
+
+func CommandNames() []string {
+	names := make([]string, 0, len(Commands))
+	for name := range Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Any response must embed ResponseMeta.
+type Response interface {
+	Meta() *ResponseMeta
+}
+
+// Common fields for all responses. The ID is copied from the request, to
+// allow callers to match responses to requests on a persistent connection.
+type ResponseMeta struct {
+	ID          json.RawMessage `json:"id,omitempty"`
+	ErrorDetail *HostError      `json:"errorDetail,omitempty"`
+	// Log entries of the request, only with "returnLogs"
+	Logs             []LogEntry `json:"logs,omitempty"`
+	DroppedLogsCount int        `json:"droppedLogsCount,omitempty"`
+}
+
+func (meta *ResponseMeta) Meta() *ResponseMeta {
+	return meta
+}
+
+// Responses may implement this to print themselves in a human readable
+// form for the CLI. Otherwise they are printed as JSON.
+type CLIPrintable interface {
+	PrintForCLI(output io.Writer) error
+}
+
+// Responses may implement this to report warnings to the standard error
+// output for the CLI, not to break the printed result.
+type CLIWarnable interface {
+	WarningsForCLI() []string
+}
+
+type ErrorResponse struct {
+	ResponseMeta
+	Error string `json:"error"`
+}
+
+func NewErrorResponse(err *HostError) *ErrorResponse {
+	response := &ErrorResponse{Error: err.Error()}
+	response.ErrorDetail = err
+	return response
+}
+
+func NewInvalidParamsError(param string, message string) *HostError {
+	return &HostError{
+		Code:    ERROR_CODE_INVALID_PARAMS,
+		Message: "invalid params: " + message,
+		Param:   param,
+	}
+}
+
+func ValidateParams(command *Command, rawParams json.RawMessage) *HostError {
+	params := map[string]json.RawMessage{}
+	if len(rawParams) > 0 {
+		var given map[string]json.RawMessage
+		if err := json.Unmarshal(rawParams, &given); err != nil {
+			return NewInvalidParamsError("", "params must be an object: "+err.Error())
+		}
+		// keys are case-insensitive as same as encoding/json
+		for key, value := range given {
+			params[strings.ToLower(key)] = value
+		}
+	}
+
+	for _, param := range command.Params {
+		value, given := params[strings.ToLower(param.Name)]
+		if !given || string(value) == "null" {
+			if param.Required {
+				return NewInvalidParamsError(param.Name, "missing required param: "+param.Name)
+			}
+			continue
+		}
+		if actual := JSONValueType(value); actual != param.Type {
+			return NewInvalidParamsError(param.Name, fmt.Sprintf("param %s must be %s but %s", param.Name, param.Type, actual))
+		}
+	}
+	return nil
+}
+
+func HasRequiredParams(command *Command) bool {
+	for _, param := range command.Params {
+		if param.Required {
+			return true
+		}
+	}
+	return false
+}
+
+func JSONValueType(value json.RawMessage) string {
+	trimmed := strings.TrimSpace(string(value))
+	if trimmed == "" {
+		return "undefined"
+	}
+	switch trimmed[0] {
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case '[':
+		return "array"
+	case '{':
+		return "object"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+func DispatchRequest(request *Request) (Response, error) {
+	command, found := Commands[request.Command]
+	if !found {
+		LogForWarn("Unknown command: " + request.Command)
+		return NewErrorResponse(&HostError{
+			Code:    ERROR_CODE_UNKNOWN_COMMAND,
+			Message: "unknown command: " + request.Command,
+		}), nil
+	}
+	if err := ValidateParams(command, request.RawParams); err != nil {
+		LogForWarn("Invalid params for " + request.Command + ": " + err.Error())
+		return NewErrorResponse(err), nil
+	}
+	if len(request.RawParams) > 0 {
+		if err := json.Unmarshal(request.RawParams, &request.Params); err != nil {
+			return NewErrorResponse(NewInvalidParamsError("", err.Error())), nil
+		}
+	}
+	return command.Handler(request)
+}
+
+func PrintCommandsUsage(output io.Writer) {
+	fmt.Fprintln(output, "available commands:")
+	for _, name := range CommandNames() {
+		command := Commands[name]
+		fmt.Fprintf(output, "  %s\n    \t%s\n", name, command.Help)
+		for _, param := range command.Params {
+			required := ""
+			if param.Required {
+				required = ", required"
+			}
+			fmt.Fprintf(output, "    \t  %s (%s%s): %s\n", param.Name, param.Type, required, param.Description)
+		}
+	}
+}
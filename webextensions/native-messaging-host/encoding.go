@@ -0,0 +1,113 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ENCODING_AUTO      = "auto"
+	ENCODING_UTF8      = "utf-8"
+	ENCODING_UTF16LE   = "utf-16le"
+	ENCODING_UTF16BE   = "utf-16be"
+	ENCODING_SJIS      = "shift_jis"
+	ENCODING_EUCJP     = "euc-jp"
+	ENCODING_ISO2022JP = "iso-2022-jp"
+)
+
+var BOMs = []struct {
+	BOM      []byte
+	Encoding string
+	Decoder  encoding.Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, ENCODING_UTF8, unicode.UTF8},
+	{[]byte{0xFF, 0xFE}, ENCODING_UTF16LE, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+	{[]byte{0xFE, 0xFF}, ENCODING_UTF16BE, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+}
+
+// Converts contents to UTF-8. A BOM always wins. Otherwise the requested
+// encoding is used, and the contents are treated as UTF-8 if no encoding is
+// requested. With "auto", common Japanese encodings are detected.
+func DecodeContents(buffer []byte, requestedEncoding string) (contents string, detectedEncoding string, hostError *HostError) {
+	for _, bom := range BOMs {
+		if bytes.HasPrefix(buffer, bom.BOM) {
+			decoded, err := bom.Decoder.NewDecoder().Bytes(buffer[len(bom.BOM):])
+			if err != nil {
+				return "", "", &HostError{Code: ERROR_CODE_ENCODING, Message: err.Error()}
+			}
+			LogForDebug("Detected BOM of " + bom.Encoding)
+			return string(decoded), bom.Encoding, nil
+		}
+	}
+
+	switch strings.ToLower(requestedEncoding) {
+	case "":
+		return string(buffer), ENCODING_UTF8, nil
+	case ENCODING_AUTO:
+		detectedEncoding = DetectEncoding(buffer)
+		LogForDebug("Detected encoding: " + detectedEncoding)
+	default:
+		detectedEncoding = requestedEncoding
+	}
+
+	decoder, err := htmlindex.Get(detectedEncoding)
+	if err != nil {
+		return "", "", &HostError{
+			Code:    ERROR_CODE_INVALID_PARAMS,
+			Message: "unknown encoding: " + requestedEncoding,
+			Param:   "encoding",
+		}
+	}
+	if name, err := htmlindex.Name(decoder); err == nil {
+		detectedEncoding = name
+	}
+	decoded, err := decoder.NewDecoder().Bytes(buffer)
+	if err != nil {
+		return "", "", &HostError{Code: ERROR_CODE_ENCODING, Message: err.Error()}
+	}
+	return string(decoded), detectedEncoding, nil
+}
+
+func DetectEncoding(buffer []byte) string {
+	if bytes.Contains(buffer, []byte("\x1b$B")) || bytes.Contains(buffer, []byte("\x1b$@")) {
+		return ENCODING_ISO2022JP
+	}
+	if utf8.Valid(buffer) {
+		return ENCODING_UTF8
+	}
+
+	// Bytes of EUC-JP are often valid as Shift_JIS, but they are decoded to
+	// half-width katakana which rarely appear in actual Shift_JIS files.
+	eucScore := CountInvalidCharacters(japanese.EUCJP, buffer) * 10
+	sjisScore := CountInvalidCharacters(japanese.ShiftJIS, buffer) * 10
+	if decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(buffer); err == nil {
+		for _, char := range string(decoded) {
+			if char >= 0xFF61 && char <= 0xFF9F {
+				sjisScore++
+			}
+		}
+	}
+	if eucScore < sjisScore {
+		return ENCODING_EUCJP
+	}
+	return ENCODING_SJIS
+}
+
+func CountInvalidCharacters(decoder encoding.Encoding, buffer []byte) int {
+	decoded, err := decoder.NewDecoder().Bytes(buffer)
+	if err != nil {
+		return len(buffer)
+	}
+	return strings.Count(string(decoded), string(utf8.RuneError))
+}
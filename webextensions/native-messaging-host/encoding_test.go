@@ -0,0 +1,61 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"testing"
+)
+
+func EncodeForTest(t *testing.T, encoder encoding.Encoding, text string) []byte {
+	t.Helper()
+	encoded, err := encoder.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return encoded
+}
+
+func TestDecodeContents(t *testing.T) {
+	text := "社外秘\n極秘\n取扱注意\n"
+	cases := []struct {
+		name      string
+		buffer    []byte
+		requested string
+		detected  string
+	}{
+		{"UTF-8", []byte(text), "", ENCODING_UTF8},
+		{"UTF-8 with BOM", append([]byte{0xEF, 0xBB, 0xBF}, text...), "", ENCODING_UTF8},
+		{"UTF-16LE with BOM", EncodeForTest(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), text), "", ENCODING_UTF16LE},
+		{"UTF-16BE with BOM", EncodeForTest(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), text), "", ENCODING_UTF16BE},
+		{"explicit Shift_JIS", EncodeForTest(t, japanese.ShiftJIS, text), "Shift_JIS", ENCODING_SJIS},
+		{"explicit alias of Shift_JIS", EncodeForTest(t, japanese.ShiftJIS, text), "windows-31j", ENCODING_SJIS},
+		{"auto UTF-8", []byte(text), ENCODING_AUTO, ENCODING_UTF8},
+		{"auto Shift_JIS", EncodeForTest(t, japanese.ShiftJIS, text), ENCODING_AUTO, ENCODING_SJIS},
+		{"auto EUC-JP", EncodeForTest(t, japanese.EUCJP, text), ENCODING_AUTO, ENCODING_EUCJP},
+		{"auto ISO-2022-JP", EncodeForTest(t, japanese.ISO2022JP, text), ENCODING_AUTO, ENCODING_ISO2022JP},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			contents, detected, err := DecodeContents(c.buffer, c.requested)
+			assert.Nil(t, err)
+			assert.Equal(t, text, contents)
+			assert.Equal(t, c.detected, detected)
+		})
+	}
+}
+
+func TestDecodeContents_UnknownEncoding(t *testing.T) {
+	_, _, err := DecodeContents([]byte("text"), "unknown")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_INVALID_PARAMS, err.Code)
+		assert.Equal(t, "encoding", err.Param)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+const (
+	ERROR_CODE_NOT_FOUND            = "not_found"
+	ERROR_CODE_PERMISSION           = "permission"
+	ERROR_CODE_ACCESS_DENIED        = "access_denied"
+	ERROR_CODE_CALLER_NOT_ALLOWED   = "caller_not_allowed"
+	ERROR_CODE_TOO_LARGE            = "too_large"
+	ERROR_CODE_CANCELLED            = "cancelled"
+	ERROR_CODE_INVALID_PARAMS       = "invalid_params"
+	ERROR_CODE_INVALID_PATH         = "invalid_path"
+	ERROR_CODE_UNKNOWN_COMMAND      = "unknown_command"
+	ERROR_CODE_UNSUPPORTED_PLATFORM = "unsupported_platform"
+	ERROR_CODE_IO                   = "io_error"
+	ERROR_CODE_NETWORK              = "network_error"
+	ERROR_CODE_HTTP                 = "http_error"
+	ERROR_CODE_ENCODING             = "encoding_error"
+	ERROR_CODE_DIALOG               = "dialog_error"
+)
+
+// Machine readable error reported to the add-on.
+type HostError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Path    string `json:"path,omitempty"`
+	Param   string `json:"param,omitempty"`
+}
+
+// Returns a human readable message, compatible to the "error" field of
+// responses in old versions.
+func (err *HostError) Error() string {
+	if err.Path != "" {
+		return err.Path + ": " + err.Message
+	}
+	return err.Message
+}
+
+func NewFileError(path string, err error) *HostError {
+	code := ERROR_CODE_IO
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = ERROR_CODE_NOT_FOUND
+	case errors.Is(err, fs.ErrPermission):
+		code = ERROR_CODE_PERMISSION
+	}
+	return &HostError{Code: code, Message: err.Error(), Path: path}
+}
@@ -0,0 +1,235 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DEFAULT_HTTP_TIMEOUT = 10 * time.Second
+
+// Overridable for testing.
+var HTTPCacheDir = ""
+
+type HTTPCacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"lastModified"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+}
+
+func IsURL(path string) bool {
+	lowerPath := strings.ToLower(path)
+	return strings.HasPrefix(lowerPath, "http://") || strings.HasPrefix(lowerPath, "https://")
+}
+
+func GetHTTPCacheDir() (string, error) {
+	if HTTPCacheDir != "" {
+		return HTTPCacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "com.clear_code.flexible_confirm_mail_we_host", "http-cache"), nil
+}
+
+func GetHTTPCachePaths(url string) (metaPath string, bodyPath string, err error) {
+	dir, err := GetHTTPCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(dir, key+".json"), filepath.Join(dir, key+".body"), nil
+}
+
+func ReadHTTPCache(url string) (*HTTPCacheEntry, []byte) {
+	metaPath, bodyPath, err := GetHTTPCachePaths(url)
+	if err != nil {
+		LogForDebug("Failed to get cache path: " + err.Error())
+		return nil, nil
+	}
+	rawMeta, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil
+	}
+	var entry HTTPCacheEntry
+	if err := json.Unmarshal(rawMeta, &entry); err != nil || entry.URL != url {
+		LogForDebug("Broken cache for " + url)
+		return nil, nil
+	}
+	body, err := ioutil.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil
+	}
+	return &entry, body
+}
+
+func WriteHTTPCache(entry *HTTPCacheEntry, body []byte) error {
+	metaPath, bodyPath, err := GetHTTPCachePaths(entry.URL)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0700); err != nil {
+		return err
+	}
+	rawMeta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(bodyPath, body, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaPath, rawMeta, 0600)
+}
+
+func CreateHTTPClient(params RequestParams) (*http.Client, *HostError) {
+	timeout := DEFAULT_HTTP_TIMEOUT
+	if params.Timeout > 0 {
+		timeout = time.Duration(params.Timeout * float64(time.Second))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if params.CABundle != "" {
+		caBundlePath := ExpandAllEnvVars(params.CABundle)
+		pem, err := ioutil.ReadFile(caBundlePath)
+		if err != nil {
+			hostError := NewFileError(params.CABundle, err)
+			hostError.Param = "caBundle"
+			return nil, hostError
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, &HostError{
+				Code:    ERROR_CODE_INVALID_PARAMS,
+				Message: "no valid certificate in the CA bundle",
+				Path:    params.CABundle,
+				Param:   "caBundle",
+			}
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: CheckRedirectAccess}, nil
+}
+
+const MAX_HTTP_REDIRECTS = 10
+
+// Redirects must not lead to URLs out of the access policy.
+func CheckRedirectAccess(request *http.Request, via []*http.Request) error {
+	if len(via) >= MAX_HTTP_REDIRECTS {
+		return fmt.Errorf("stopped after %d redirects", MAX_HTTP_REDIRECTS)
+	}
+	if hostError := CheckURLAccess(request.URL.String()); hostError != nil {
+		return hostError
+	}
+	return nil
+}
+
+// Fetches contents from an HTTP(S) server. Successful responses are cached
+// and revalidated with ETag and Last-Modified, and the cache is used as a
+// fallback while the server is unreachable.
+func FetchURL(url string, params RequestParams) (contents string, cached bool, hostError *HostError) {
+	if hostError := CheckURLAccess(url); hostError != nil {
+		return "", false, hostError
+	}
+
+	client, hostError := CreateHTTPClient(params)
+	if hostError != nil {
+		return "", false, hostError
+	}
+
+	cacheEntry, cachedBody := ReadHTTPCache(url)
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, &HostError{Code: ERROR_CODE_INVALID_PATH, Message: err.Error(), Path: url}
+	}
+	if cacheEntry != nil {
+		if cacheEntry.ETag != "" {
+			request.Header.Set("If-None-Match", cacheEntry.ETag)
+		}
+		if cacheEntry.LastModified != "" {
+			request.Header.Set("If-Modified-Since", cacheEntry.LastModified)
+		}
+	}
+
+	response, err := client.Do(request)
+	var deniedError *HostError
+	if errors.As(err, &deniedError) {
+		return "", false, deniedError
+	}
+	if err != nil {
+		LogForWarn("Failed to fetch " + url + ": " + err.Error())
+		if cacheEntry != nil {
+			LogForInfo("Use cached contents fetched at " + cacheEntry.FetchedAt.String())
+			return string(cachedBody), true, nil
+		}
+		return "", false, &HostError{Code: ERROR_CODE_NETWORK, Message: err.Error(), Path: url}
+	}
+	defer response.Body.Close()
+
+	LogForDebug("Response for " + url + ": " + response.Status)
+	switch {
+	case response.StatusCode == http.StatusNotModified && cacheEntry != nil:
+		return string(cachedBody), true, nil
+	case response.StatusCode == http.StatusOK:
+		// Don't read endless responses into the memory.
+		body, err := ioutil.ReadAll(io.LimitReader(response.Body, MAX_DOWNLOAD_SIZE+1))
+		if err != nil {
+			if cacheEntry != nil {
+				return string(cachedBody), true, nil
+			}
+			return "", false, &HostError{Code: ERROR_CODE_NETWORK, Message: err.Error(), Path: url}
+		}
+		if len(body) > MAX_DOWNLOAD_SIZE {
+			return "", false, NewTooLargeDownloadError(url)
+		}
+		entry := &HTTPCacheEntry{
+			URL:          url,
+			ETag:         response.Header.Get("ETag"),
+			LastModified: response.Header.Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+		}
+		if err := WriteHTTPCache(entry, body); err != nil {
+			LogForWarn("Failed to write cache for " + url + ": " + err.Error())
+		}
+		return string(body), false, nil
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		return "", false, &HostError{Code: ERROR_CODE_NOT_FOUND, Message: response.Status, Path: url}
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		return "", false, &HostError{Code: ERROR_CODE_PERMISSION, Message: response.Status, Path: url}
+	case response.StatusCode >= 500 && cacheEntry != nil:
+		LogForInfo("Use cached contents fetched at " + cacheEntry.FetchedAt.String())
+		return string(cachedBody), true, nil
+	default:
+		return "", false, &HostError{
+			Code:    ERROR_CODE_HTTP,
+			Message: fmt.Sprintf("unexpected response: %s", response.Status),
+			Path:    url,
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func UseTempHTTPCacheDir(t *testing.T) {
+	t.Helper()
+	HTTPCacheDir = t.TempDir()
+	t.Cleanup(func() {
+		HTTPCacheDir = ""
+	})
+}
+
+func TestFetchURL_CacheRevalidation(t *testing.T) {
+	UseTempHTTPCacheDir(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		if request.Header.Get("If-None-Match") == `"v1"` {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("ETag", `"v1"`)
+		writer.Write([]byte("example.com\nexample.net\n"))
+	}))
+	url := server.URL + "/domains.txt"
+
+	contents, cached, err := FetchURL(url, RequestParams{})
+	assert.Nil(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, "example.com\nexample.net\n", contents)
+
+	contents, cached, err = FetchURL(url, RequestParams{})
+	assert.Nil(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, "example.com\nexample.net\n", contents)
+	assert.Equal(t, 2, requests)
+
+	server.Close()
+	contents, cached, err = FetchURL(url, RequestParams{})
+	assert.Nil(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, "example.com\nexample.net\n", contents)
+}
+
+func TestFetchURL_Errors(t *testing.T) {
+	UseTempHTTPCacheDir(t)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/forbidden":
+			writer.WriteHeader(http.StatusForbidden)
+		case "/broken":
+			writer.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		path string
+		code string
+	}{
+		{"/missing", ERROR_CODE_NOT_FOUND},
+		{"/forbidden", ERROR_CODE_PERMISSION},
+		{"/broken", ERROR_CODE_HTTP},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			_, _, err := FetchURL(server.URL+c.path, RequestParams{})
+			if assert.NotNil(t, err) {
+				assert.Equal(t, c.code, err.Code)
+				assert.Equal(t, server.URL+c.path, err.Path)
+			}
+		})
+	}
+
+	server.Close()
+	_, _, err := FetchURL(server.URL+"/unreachable", RequestParams{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_NETWORK, err.Code)
+	}
+}
+
+func TestFetchURL_CABundle(t *testing.T) {
+	UseTempHTTPCacheDir(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("secure"))
+	}))
+	defer server.Close()
+
+	_, _, err := FetchURL(server.URL, RequestParams{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_NETWORK, err.Code)
+	}
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caBundle, certificate, 0644))
+
+	contents, _, err := FetchURL(server.URL, RequestParams{CABundle: caBundle})
+	assert.Nil(t, err)
+	assert.Equal(t, "secure", contents)
+}
+
+func TestFetchURL_RedirectDeniedByAccessPolicy(t *testing.T) {
+	UseTempHTTPCacheDir(t)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/lists/moved":
+			http.Redirect(writer, request, "/lists/domains.txt", http.StatusFound)
+		case "/lists/escape":
+			http.Redirect(writer, request, "/secret.txt", http.StatusFound)
+		default:
+			writer.Write([]byte("example.com"))
+		}
+	}))
+	defer server.Close()
+	UseAccessPolicy(t, &AccessPolicy{URLPrefixes: []string{server.URL + "/lists/"}})
+
+	contents, _, err := FetchURL(server.URL+"/lists/moved", RequestParams{})
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", contents)
+
+	_, _, err = FetchURL(server.URL+"/lists/escape", RequestParams{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_ACCESS_DENIED, err.Code)
+		assert.Equal(t, server.URL+"/secret.txt", err.Path)
+	}
+}
+
+func TestFetchURL_TooLarge(t *testing.T) {
+	UseTempHTTPCacheDir(t)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		size := MAX_RESPONSE_SIZE + 1
+		if request.URL.Path == "/huge.txt" {
+			size = MAX_DOWNLOAD_SIZE + 1
+		}
+		writer.Write([]byte(strings.Repeat("a", size)))
+	}))
+	defer server.Close()
+
+	// Contents larger than a message are returned in chunks.
+	contents, _, err := FetchURL(server.URL+"/large.txt", RequestParams{})
+	assert.Nil(t, err)
+	assert.Len(t, contents, MAX_RESPONSE_SIZE+1)
+
+	_, _, err = FetchURL(server.URL+"/huge.txt", RequestParams{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_TOO_LARGE, err.Code)
+		assert.Equal(t, server.URL+"/huge.txt", err.Path)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	FILE_DIALOG_MODE_OPEN      = "open"
+	FILE_DIALOG_MODE_SAVE      = "save"
+	FILE_DIALOG_MODE_DIRECTORY = "directory"
+)
+
+var ErrFileDialogCancelled = errors.New("cancelled")
+
+// Returned by backends which turned out to be unusable while opening a
+// dialog, to fall back to the next backend.
+var ErrFileDialogUnavailable = errors.New("file dialog is unavailable")
+
+// Backend of file choosers, like xdg-desktop-portal or zenity.
+type FileDialog interface {
+	Name() string
+	Available() bool
+	// Multiple paths are returned only for the open mode with
+	// params.Multiple.
+	Choose(mode string, params RequestParams) ([]string, error)
+}
+
+// Tries dialogs in the order until one of them is available.
+func ChooseWithFileDialogs(dialogs []FileDialog, mode string, params RequestParams) ([]string, *HostError) {
+	for _, dialog := range dialogs {
+		if !dialog.Available() {
+			LogForDebug("File dialog is not available: " + dialog.Name())
+			continue
+		}
+		LogForDebug("Choose (" + mode + ") with " + dialog.Name() + ", filename = " + params.FileName)
+		paths, err := dialog.Choose(mode, params)
+		if errors.Is(err, ErrFileDialogUnavailable) {
+			LogForDebug("Failed to open file dialog with " + dialog.Name() + ": " + err.Error())
+			continue
+		}
+		if errors.Is(err, ErrFileDialogCancelled) {
+			LogForDebug("Canceled")
+			return nil, &HostError{Code: ERROR_CODE_CANCELLED, Message: "cancelled"}
+		}
+		if err != nil {
+			LogForDebug("Failed: " + err.Error())
+			return nil, &HostError{Code: ERROR_CODE_DIALOG, Message: err.Error()}
+		}
+		return paths, nil
+	}
+	return nil, &HostError{
+		Code:    ERROR_CODE_UNSUPPORTED_PLATFORM,
+		Message: "no file chooser is available",
+	}
+}
+
+// Patterns are given like "*.txt;*.csv", same to filters of Windows.
+func SplitFilePatterns(pattern string) []string {
+	patterns := []string{}
+	for _, part := range strings.Split(pattern, ";") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			patterns = append(patterns, part)
+		}
+	}
+	return patterns
+}
+
+// Returns the initial path of the dialog, from the initial directory and
+// the file name.
+func GetFileDialogInitialPath(params RequestParams) string {
+	if params.Path == "" || filepath.IsAbs(params.FileName) {
+		return params.FileName
+	}
+	if params.FileName == "" {
+		// A trailing separator means a directory for zenity and kdialog.
+		return strings.TrimSuffix(params.Path, string(filepath.Separator)) + string(filepath.Separator)
+	}
+	return filepath.Join(params.Path, params.FileName)
+}
+
+// Parses the result of GetOpenFileNameW with OFN_ALLOWMULTISELECT and
+// OFN_EXPLORER: the directory and file names separated by NUL and terminated
+// by double NULs, or just a path if only one file is chosen.
+func ParseOpenFileNameResult(buffer []uint16) []string {
+	parts := []string{}
+	from := 0
+	for index, unit := range buffer {
+		if unit != 0 {
+			continue
+		}
+		if index == from {
+			break
+		}
+		parts = append(parts, string(utf16.Decode(buffer[from:index])))
+		from = index + 1
+	}
+	if len(parts) <= 1 {
+		return parts
+	}
+	dir := strings.TrimSuffix(parts[0], `\`)
+	paths := []string{}
+	for _, name := range parts[1:] {
+		paths = append(paths, dir+`\`+name)
+	}
+	return paths
+}
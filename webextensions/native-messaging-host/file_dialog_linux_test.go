@@ -0,0 +1,80 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuildPortalOptions(t *testing.T) {
+	options := BuildPortalOptions(FILE_DIALOG_MODE_OPEN, RequestParams{
+		Path:        "/home/user",
+		DisplayName: "Lists",
+		Pattern:     "*.txt;*.csv",
+	})
+	filter := PortalFileFilter{"Lists", []PortalFileFilterRule{{0, "*.txt"}, {0, "*.csv"}}}
+	assert.Equal(t, dbus.MakeVariant(true), options["modal"])
+	assert.Equal(t, dbus.MakeVariant([]PortalFileFilter{filter}), options["filters"])
+	assert.Equal(t, "a(sa(us))", options["filters"].Signature().String())
+	assert.Equal(t, dbus.MakeVariant(filter), options["current_filter"])
+	assert.Equal(t, dbus.MakeVariant([]byte("/home/user\x00")), options["current_folder"])
+
+	_, isMultiple := options["multiple"]
+	assert.False(t, isMultiple)
+	options = BuildPortalOptions(FILE_DIALOG_MODE_OPEN, RequestParams{Multiple: true})
+	assert.Equal(t, dbus.MakeVariant(true), options["multiple"])
+
+	options = BuildPortalOptions(FILE_DIALOG_MODE_SAVE, RequestParams{FileName: "/tmp/list.txt", Multiple: true})
+	_, isMultiple = options["multiple"]
+	assert.False(t, isMultiple)
+	assert.Equal(t, dbus.MakeVariant([]byte("/tmp\x00")), options["current_folder"])
+	assert.Equal(t, dbus.MakeVariant("list.txt"), options["current_name"])
+	_, hasFilters := options["filters"]
+	assert.False(t, hasFilters)
+
+	options = BuildPortalOptions(FILE_DIALOG_MODE_DIRECTORY, RequestParams{DisplayName: "Lists", Pattern: "*.txt"})
+	assert.Equal(t, dbus.MakeVariant(true), options["directory"])
+	_, hasFilters = options["filters"]
+	assert.False(t, hasFilters)
+}
+
+func TestParsePortalResponse(t *testing.T) {
+	paths, err := ParsePortalResponse([]interface{}{
+		uint32(PORTAL_RESPONSE_SUCCESS),
+		map[string]dbus.Variant{"uris": dbus.MakeVariant([]string{"file:///home/user/My%20Lists/a.txt", "file:///tmp/b.txt"})},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/home/user/My Lists/a.txt", "/tmp/b.txt"}, paths)
+
+	_, err = ParsePortalResponse([]interface{}{uint32(PORTAL_RESPONSE_CANCELLED), map[string]dbus.Variant{}})
+	assert.Equal(t, ErrFileDialogCancelled, err)
+
+	_, err = ParsePortalResponse([]interface{}{uint32(2), map[string]dbus.Variant{}})
+	assert.EqualError(t, err, "file chooser failed with the response 2")
+
+	_, err = PortalURIToPath("https://example.com/list.txt")
+	assert.EqualError(t, err, "not a local file: https://example.com/list.txt")
+}
+
+func TestBuildKDialogArgs(t *testing.T) {
+	params := RequestParams{Title: "Choose", Path: "/home/user", FileName: "list.txt", DisplayName: "Lists", Pattern: "*.txt;*.csv"}
+	assert.Equal(t,
+		[]string{"--getopenfilename", "/home/user/list.txt", "Lists (*.txt *.csv)", "--title", "Choose"},
+		BuildKDialogArgs(FILE_DIALOG_MODE_OPEN, params))
+	params.Multiple = true
+	assert.Equal(t,
+		[]string{"--getopenfilename", "--multiple", "--separate-output", "/home/user/list.txt", "Lists (*.txt *.csv)", "--title", "Choose"},
+		BuildKDialogArgs(FILE_DIALOG_MODE_OPEN, params))
+	assert.Equal(t,
+		[]string{"--getsavefilename", "/home/user/list.txt", "Lists (*.txt *.csv)", "--title", "Choose"},
+		BuildKDialogArgs(FILE_DIALOG_MODE_SAVE, params))
+	assert.Equal(t,
+		[]string{"--getexistingdirectory", "/home/user/", "--title", "Choose"},
+		BuildKDialogArgs(FILE_DIALOG_MODE_DIRECTORY, RequestParams{Title: "Choose", Path: "/home/user", DisplayName: "Lists", Pattern: "*.txt"}))
+}
@@ -0,0 +1,67 @@
+//go:build !windows && !darwin
+
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Overridable for testing.
+var FileDialogs = []FileDialog{ZenityFileDialog{}, KDialogFileDialog{}}
+
+// File chooser of KDE.
+type KDialogFileDialog struct{}
+
+func (dialog KDialogFileDialog) Name() string {
+	return "kdialog"
+}
+
+func (dialog KDialogFileDialog) Available() bool {
+	_, err := exec.LookPath("kdialog")
+	return err == nil
+}
+
+func (dialog KDialogFileDialog) Choose(mode string, params RequestParams) ([]string, error) {
+	output, err := exec.Command("kdialog", BuildKDialogArgs(mode, params)...).Output()
+	if exitError, isExitError := err.(*exec.ExitError); isExitError && exitError.ExitCode() == 1 {
+		return nil, ErrFileDialogCancelled
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Paths are printed line by line with --separate-output.
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), nil
+}
+
+var KDialogModeOptions = map[string]string{
+	FILE_DIALOG_MODE_OPEN:      "--getopenfilename",
+	FILE_DIALOG_MODE_SAVE:      "--getsavefilename",
+	FILE_DIALOG_MODE_DIRECTORY: "--getexistingdirectory",
+}
+
+func BuildKDialogArgs(mode string, params RequestParams) []string {
+	initialPath := GetFileDialogInitialPath(params)
+	if initialPath == "" {
+		initialPath, _ = os.UserHomeDir()
+	}
+	args := []string{KDialogModeOptions[mode], initialPath}
+	if mode == FILE_DIALOG_MODE_OPEN && params.Multiple {
+		args = append(args[:1], "--multiple", "--separate-output", initialPath)
+	}
+	if mode != FILE_DIALOG_MODE_DIRECTORY && params.DisplayName != "" && params.Pattern != "" {
+		args = append(args, fmt.Sprintf("%s (%s)", params.DisplayName, strings.Join(SplitFilePatterns(params.Pattern), " ")))
+	}
+	if params.Title != "" {
+		args = append(args, "--title", params.Title)
+	}
+	return args
+}
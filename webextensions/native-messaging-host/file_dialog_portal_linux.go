@@ -0,0 +1,195 @@
+//go:build linux
+
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"net/url"
+	"path/filepath"
+)
+
+const (
+	PORTAL_BUS_NAME               = "org.freedesktop.portal.Desktop"
+	PORTAL_OBJECT_PATH            = "/org/freedesktop/portal/desktop"
+	PORTAL_FILE_CHOOSER_INTERFACE = "org.freedesktop.portal.FileChooser"
+	PORTAL_REQUEST_INTERFACE      = "org.freedesktop.portal.Request"
+)
+
+// Response codes of org.freedesktop.portal.Request.Response.
+const (
+	PORTAL_RESPONSE_SUCCESS   = 0
+	PORTAL_RESPONSE_CANCELLED = 1
+)
+
+func init() {
+	// Prefer the portal to dialog commands.
+	FileDialogs = append([]FileDialog{PortalFileDialog{}}, FileDialogs...)
+}
+
+// File chooser of xdg-desktop-portal, available also in sandboxes like
+// Flatpak and Snap.
+type PortalFileDialog struct{}
+
+// Same to the signature "(sa(us))" of filters.
+type PortalFileFilter struct {
+	Name  string
+	Rules []PortalFileFilterRule
+}
+
+type PortalFileFilterRule struct {
+	Type    uint32 // 0 for glob patterns, 1 for MIME types
+	Pattern string
+}
+
+func (dialog PortalFileDialog) Name() string {
+	return "xdg-desktop-portal"
+}
+
+func (dialog PortalFileDialog) Available() bool {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return false
+	}
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err == nil && containsString(names, PORTAL_BUS_NAME) {
+		return true
+	}
+	// The portal is started on demand.
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&names); err == nil && containsString(names, PORTAL_BUS_NAME) {
+		return true
+	}
+	return false
+}
+
+func (dialog PortalFileDialog) Choose(mode string, params RequestParams) ([]string, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileDialogUnavailable, err.Error())
+	}
+
+	// Listen before calling, not to miss the response.
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+	matchOptions := []dbus.MatchOption{
+		dbus.WithMatchInterface(PORTAL_REQUEST_INTERFACE),
+		dbus.WithMatchMember("Response"),
+	}
+	if err := conn.AddMatchSignal(matchOptions...); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileDialogUnavailable, err.Error())
+	}
+	defer conn.RemoveMatchSignal(matchOptions...)
+
+	method := PORTAL_FILE_CHOOSER_INTERFACE + ".OpenFile"
+	if mode == FILE_DIALOG_MODE_SAVE {
+		method = PORTAL_FILE_CHOOSER_INTERFACE + ".SaveFile"
+	}
+	var handle dbus.ObjectPath
+	portal := conn.Object(PORTAL_BUS_NAME, PORTAL_OBJECT_PATH)
+	// The parent window is unknown for native messaging hosts.
+	err = portal.Call(method, 0, "", params.Title, BuildPortalOptions(mode, params)).Store(&handle)
+	if err != nil {
+		// No backend implements FileChooser, for example.
+		return nil, fmt.Errorf("%w: %s", ErrFileDialogUnavailable, err.Error())
+	}
+
+	for signal := range signals {
+		if signal.Path != handle || signal.Name != PORTAL_REQUEST_INTERFACE+".Response" {
+			continue
+		}
+		return ParsePortalResponse(signal.Body)
+	}
+	return nil, errors.New("connection to the session bus is closed")
+}
+
+func BuildPortalOptions(mode string, params RequestParams) map[string]dbus.Variant {
+	options := map[string]dbus.Variant{
+		"modal": dbus.MakeVariant(true),
+	}
+	switch mode {
+	case FILE_DIALOG_MODE_OPEN:
+		if params.Multiple {
+			options["multiple"] = dbus.MakeVariant(true)
+		}
+	case FILE_DIALOG_MODE_SAVE:
+		if params.FileName != "" {
+			options["current_name"] = dbus.MakeVariant(filepath.Base(params.FileName))
+		}
+	case FILE_DIALOG_MODE_DIRECTORY:
+		// Supported by the version 3 or later.
+		options["directory"] = dbus.MakeVariant(true)
+	}
+	if mode != FILE_DIALOG_MODE_DIRECTORY && params.DisplayName != "" && params.Pattern != "" {
+		filter := PortalFileFilter{Name: params.DisplayName, Rules: []PortalFileFilterRule{}}
+		for _, pattern := range SplitFilePatterns(params.Pattern) {
+			filter.Rules = append(filter.Rules, PortalFileFilterRule{0, pattern})
+		}
+		options["filters"] = dbus.MakeVariant([]PortalFileFilter{filter})
+		options["current_filter"] = dbus.MakeVariant(filter)
+	}
+	folder := params.Path
+	if folder == "" && filepath.IsAbs(params.FileName) {
+		folder = filepath.Dir(params.FileName)
+	}
+	if folder != "" {
+		// A NUL terminated byte array.
+		options["current_folder"] = dbus.MakeVariant(append([]byte(folder), 0))
+	}
+	return options
+}
+
+func ParsePortalResponse(body []interface{}) ([]string, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("unexpected response: %v", body)
+	}
+	response, _ := body[0].(uint32)
+	results, _ := body[1].(map[string]dbus.Variant)
+	switch response {
+	case PORTAL_RESPONSE_SUCCESS:
+	case PORTAL_RESPONSE_CANCELLED:
+		return nil, ErrFileDialogCancelled
+	default:
+		return nil, fmt.Errorf("file chooser failed with the response %d", response)
+	}
+	uris, _ := results["uris"].Value().([]string)
+	if len(uris) == 0 {
+		return nil, ErrFileDialogCancelled
+	}
+	paths := []string{}
+	for _, uri := range uris {
+		path, err := PortalURIToPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func PortalURIToPath(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "file" {
+		return "", fmt.Errorf("not a local file: %s", uri)
+	}
+	return parsed.Path, nil
+}
+
+func containsString(list []string, item string) bool {
+	for _, listItem := range list {
+		if listItem == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+type FakeFileDialog struct {
+	name      string
+	available bool
+	paths     []string
+	err       error
+	mode      string
+	params    *RequestParams
+}
+
+func (dialog *FakeFileDialog) Name() string {
+	return dialog.name
+}
+
+func (dialog *FakeFileDialog) Available() bool {
+	return dialog.available
+}
+
+func (dialog *FakeFileDialog) Choose(mode string, params RequestParams) ([]string, error) {
+	dialog.mode = mode
+	dialog.params = &params
+	return dialog.paths, dialog.err
+}
+
+func TestChooseWithFileDialogs_Fallback(t *testing.T) {
+	unavailable := &FakeFileDialog{name: "unavailable"}
+	broken := &FakeFileDialog{name: "broken", available: true, err: ErrFileDialogUnavailable}
+	working := &FakeFileDialog{name: "working", available: true, paths: []string{"/tmp/domains.txt"}}
+	params := RequestParams{Title: "Choose", DisplayName: "Text", Pattern: "*.txt"}
+
+	paths, err := ChooseWithFileDialogs([]FileDialog{unavailable, broken, working}, FILE_DIALOG_MODE_SAVE, params)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/tmp/domains.txt"}, paths)
+	assert.Nil(t, unavailable.params)
+	assert.Equal(t, params, *broken.params)
+	assert.Equal(t, params, *working.params)
+	assert.Equal(t, FILE_DIALOG_MODE_SAVE, working.mode)
+}
+
+func TestChooseWithFileDialogs_Errors(t *testing.T) {
+	_, err := ChooseWithFileDialogs([]FileDialog{&FakeFileDialog{available: true, err: ErrFileDialogCancelled}}, FILE_DIALOG_MODE_OPEN, RequestParams{})
+	assert.Equal(t, ERROR_CODE_CANCELLED, err.Code)
+
+	_, err = ChooseWithFileDialogs([]FileDialog{&FakeFileDialog{available: true, err: errors.New("crashed")}}, FILE_DIALOG_MODE_OPEN, RequestParams{})
+	assert.Equal(t, &HostError{Code: ERROR_CODE_DIALOG, Message: "crashed"}, err)
+
+	_, err = ChooseWithFileDialogs([]FileDialog{&FakeFileDialog{}}, FILE_DIALOG_MODE_OPEN, RequestParams{})
+	assert.Equal(t, ERROR_CODE_UNSUPPORTED_PLATFORM, err.Code)
+}
+
+func TestSplitFilePatterns(t *testing.T) {
+	assert.Equal(t, []string{"*.txt", "*.csv"}, SplitFilePatterns("*.txt; *.csv;"))
+	assert.Equal(t, []string{}, SplitFilePatterns(""))
+}
+
+func TestGetFileDialogInitialPath(t *testing.T) {
+	dir := filepath.Join("home", "user")
+	assert.Equal(t, "list.txt", GetFileDialogInitialPath(RequestParams{FileName: "list.txt"}))
+	assert.Equal(t, filepath.Join(dir, "list.txt"), GetFileDialogInitialPath(RequestParams{Path: dir, FileName: "list.txt"}))
+	assert.Equal(t, dir+string(filepath.Separator), GetFileDialogInitialPath(RequestParams{Path: dir}))
+}
+
+func TestParseOpenFileNameResult(t *testing.T) {
+	assert.Equal(t,
+		[]string{`C:\Lists\a.txt`, `C:\Lists\b.txt`},
+		ParseOpenFileNameResult(utf16.Encode([]rune("C:\\Lists\x00a.txt\x00b.txt\x00\x00garbage"))))
+	assert.Equal(t,
+		[]string{`C:\a.txt`, `C:\b.txt`},
+		ParseOpenFileNameResult(utf16.Encode([]rune("C:\\\x00a.txt\x00b.txt\x00\x00"))))
+	assert.Equal(t,
+		[]string{`C:\Lists\a.txt`},
+		ParseOpenFileNameResult(utf16.Encode([]rune("C:\\Lists\\a.txt\x00\x00"))))
+	assert.Equal(t, []string{}, ParseOpenFileNameResult(make([]uint16, 8)))
+}
+
+func TestNewChooseFileResponse(t *testing.T) {
+	response := NewChooseFileResponse([]string{"/tmp/a.txt", "/tmp/b.txt"}, nil)
+	assert.Equal(t, "/tmp/a.txt", response.Path)
+	assert.Equal(t, []string{"/tmp/a.txt", "/tmp/b.txt"}, response.Paths)
+
+	response = NewChooseFileResponse(nil, &HostError{Code: ERROR_CODE_CANCELLED, Message: "cancelled"})
+	assert.Equal(t, "", response.Path)
+	assert.Equal(t, []string{}, response.Paths)
+	assert.True(t, response.Cancelled)
+	assert.Equal(t, "", response.Error)
+	assert.Equal(t, ERROR_CODE_CANCELLED, response.ErrorDetail.Code)
+
+	response = NewChooseFileResponse(nil, &HostError{Code: ERROR_CODE_DIALOG, Message: "crashed"})
+	assert.False(t, response.Cancelled)
+	assert.Equal(t, "crashed", response.Error)
+	assert.Equal(t, ERROR_CODE_DIALOG, response.ErrorDetail.Code)
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/ncruces/zenity"
+)
+
+// File chooser of the zenity package: the zenity command (or compatible ones
+// like qarma) on Linux, and AppleScript on macOS.
+type ZenityFileDialog struct{}
+
+func (dialog ZenityFileDialog) Name() string {
+	return "zenity"
+}
+
+func (dialog ZenityFileDialog) Available() bool {
+	return zenity.IsAvailable()
+}
+
+func (dialog ZenityFileDialog) Choose(mode string, params RequestParams) ([]string, error) {
+	var filenames []string
+	var err error
+	options := BuildZenityOptions(mode, params)
+	switch {
+	case mode == FILE_DIALOG_MODE_SAVE:
+		var filename string
+		filename, err = zenity.SelectFileSave(options...)
+		filenames = []string{filename}
+	case mode == FILE_DIALOG_MODE_OPEN && params.Multiple:
+		filenames, err = zenity.SelectFileMultiple(options...)
+	default:
+		var filename string
+		filename, err = zenity.SelectFile(options...)
+		filenames = []string{filename}
+	}
+	if err == zenity.ErrCanceled {
+		return nil, ErrFileDialogCancelled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filenames, nil
+}
+
+func BuildZenityOptions(mode string, params RequestParams) []zenity.Option {
+	options := []zenity.Option{
+		zenity.Title(params.Title),
+		zenity.Filename(GetFileDialogInitialPath(params)),
+	}
+	switch mode {
+	case FILE_DIALOG_MODE_SAVE:
+		options = append(options, zenity.ConfirmOverwrite())
+	case FILE_DIALOG_MODE_DIRECTORY:
+		return append(options, zenity.Directory())
+	}
+	if params.DisplayName != "" && params.Pattern != "" {
+		options = append(options, zenity.FileFilters{
+			{Name: params.DisplayName, Patterns: SplitFilePatterns(params.Pattern), CaseFold: true},
+		})
+	}
+	return options
+}
@@ -3,12 +3,15 @@ module host
 go 1.18
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/harry1453/go-common-file-dialog v1.2.0
 	github.com/lestrrat/go-file-rotatelogs v0.0.0-20180223000712-d3151e2a480f
 	github.com/lhside/chrome-go v0.0.0-20150930231719-5fc75372b55c
 	github.com/ncruces/zenity v0.10.5
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/sys v0.3.0
+	golang.org/x/text v0.5.0
+	howett.net/plist v1.0.0
 )
 
 require (
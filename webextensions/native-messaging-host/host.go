@@ -7,7 +7,9 @@
 package main
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	rotatelogs "github.com/lestrrat/go-file-rotatelogs"
@@ -18,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -25,47 +28,58 @@ import (
 const VERSION = "4.2.11"
 
 var RunInCLI bool
-var DebugLogs []string
-var Logging bool
-var Debug bool
 var ErrorOut io.Writer
 
-func LogForInfo(message string) {
-	DebugLogs = append(DebugLogs, message)
-	if Logging {
-		if !RunInCLI {
-			fmt.Fprintf(ErrorOut, "[info] "+message+"\n")
-		}
-		log.Print(message + "\r\n")
-	}
-}
-
-func LogForDebug(message string) {
-	DebugLogs = append(DebugLogs, message)
-	if Logging && Debug {
-		if !RunInCLI {
-			fmt.Fprintf(ErrorOut, "[debug] "+message+"\n")
-		}
-		log.Print(message + "\r\n")
-	}
-}
-
 type RequestParams struct {
-	Path             string `json:"path"`
-	Title            string `json:"title"`
-	Role             string `json:"role"` // obsolete, not used
-	FileName         string `json:"fileName"`
-	DefaultExtension string `json:"defaultExtension"`
-	DisplayName      string `json:"displayName"`
-	Pattern          string `json:"pattern"`
+	Path             string  `json:"path"`
+	Title            string  `json:"title"`
+	Role             string  `json:"role"` // obsolete, not used
+	FileName         string  `json:"fileName"`
+	DefaultExtension string  `json:"defaultExtension"`
+	DisplayName      string  `json:"displayName"`
+	Pattern          string  `json:"pattern"`
+	Multiple         bool    `json:"multiple"` // allow choosing multiple files
+	Timeout          float64 `json:"timeout"`  // seconds, for URLs
+	CABundle         string  `json:"caBundle"` // path to a PEM file, for URLs
+	Encoding         string  `json:"encoding"` // "auto" or an encoding name
+	Format           string  `json:"format"`   // format of a list file: "auto", "lines", "csv" or "json"
+	Section          string  `json:"section"`  // section of a list file to be read
+
+	// Configs of the add-on, for merged-config
+	Defaults map[string]interface{} `json:"defaults"`
+	Managed  map[string]interface{} `json:"managed"`
+	User     map[string]interface{} `json:"user"`
 }
 type Request struct {
-	Logging          bool          `json:"logging"`
-	Debug            bool          `json:"debug"`
-	LogRotationCount int           `json:"logRotationCount"`
-	LogRotationTime  int           `json:"logRotationTime"`
-	Command          string        `json:"command"`
-	Params           RequestParams `json:"params"`
+	ID               json.RawMessage `json:"id,omitempty"`
+	Logging          bool            `json:"logging"`
+	Debug            bool            `json:"debug"`
+	LogRotationCount int             `json:"logRotationCount"`
+	LogRotationTime  int             `json:"logRotationTime"`
+	LogDirectory     string          `json:"logDirectory"` // overrides the default log directory
+	LogLevel         string          `json:"logLevel"`     // "error", "warn", "info", "debug" or "trace"
+	LogFormat        string          `json:"logFormat"`    // "json" or "text"
+	Unredacted       bool            `json:"unredacted"`   // don't mask personal information in logs
+	SensitiveTerms   []string        `json:"sensitiveTerms"`
+	Command          string          `json:"command"`
+	Chunked          bool            `json:"chunked"`    // the caller can receive chunked responses
+	ReturnLogs       bool            `json:"returnLogs"` // include log entries of the request in the response
+	Params           RequestParams   `json:"-"`          // parsed from RawParams after validation
+	RawParams        json.RawMessage `json:"params"`
+	CallerID         string          `json:"-"` // ID of the add-on, given by Thunderbird
+}
+
+func ParseRequest(rawRequest []byte) (*Request, error) {
+	request := &Request{
+		Logging:          false,
+		Debug:            false,
+		LogRotationCount: 7,
+		LogRotationTime:  24,
+	}
+	if err := json.Unmarshal(rawRequest, request); err != nil {
+		return nil, err
+	}
+	return request, nil
 }
 
 type Context struct {
@@ -73,11 +87,71 @@ type Context struct {
 	Command       string
 	CommandParams string
 	Debug         bool
+	Unredacted    bool
+	ManifestPath  string
+	CallerID      string
 	Input         io.Reader
 	Output        io.Writer
 	ErrorOut      io.Writer
 }
 
+var FetchParams = []CommandParam{
+	{"path", "string", true, "path to the file or HTTP(S) URL to be read"},
+	{"timeout", "number", false, "timeout in seconds for an URL"},
+	{"caBundle", "string", false, "path to a PEM file of additional CA certificates for an URL"},
+	{"encoding", "string", false, `encoding of the contents, or "auto" to detect Japanese encodings`},
+}
+
+var ChooseFileParams = []CommandParam{
+	{"title", "string", false, "title of the dialog"},
+	{"role", "string", false, "obsolete, not used"},
+	{"path", "string", false, "initial directory"},
+	{"fileName", "string", false, "initial file name"},
+	{"defaultExtension", "string", false, "extension appended to the file name if not given"},
+	{"displayName", "string", false, "name of the filter"},
+	{"pattern", "string", false, "matching file pattern of the filter"},
+	{"multiple", "boolean", false, "allow choosing multiple files, only for choose-file"},
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:    "fetch",
+		Params:  FetchParams,
+		Help:    "read contents of a file or an URL",
+		Example: `{"path":"c:\\path\\to\\file"}`,
+		Handler: HandleFetch,
+	})
+	RegisterCommand(&Command{
+		Name:    "choose-file",
+		Params:  ChooseFileParams,
+		Help:    "show a dialog to choose a file and return its path",
+		Example: `{"title":"dialog title","fileName":"file.txt","displayName":"name of the filter","pattern":"*.txt"}`,
+		Handler: HandleChooseFile,
+	})
+	RegisterCommand(&Command{
+		Name:    "choose-save-file",
+		Params:  ChooseFileParams,
+		Help:    "show a dialog to choose a file to be saved and return its path",
+		Example: `{"title":"dialog title","fileName":"configs.json","defaultExtension":"json","displayName":"JSON","pattern":"*.json"}`,
+		Handler: HandleChooseSaveFile,
+	})
+	RegisterCommand(&Command{
+		Name: "choose-directory",
+		Params: []CommandParam{
+			{"title", "string", false, "title of the dialog"},
+			{"path", "string", false, "initial directory"},
+		},
+		Help:    "show a dialog to choose a directory and return its path",
+		Example: `{"title":"dialog title"}`,
+		Handler: HandleChooseDirectory,
+	})
+	RegisterCommand(&Command{
+		Name:    "outlook-gpo-configs",
+		Help:    "read configs provided via group policy for FlexConfirmMail for Outlook",
+		Handler: HandleOutlookGPOConfigs,
+	})
+}
+
 func main() {
 	context, err := CreateCommandLineContext(os.Args[1:])
 	if err != nil {
@@ -99,16 +173,30 @@ func CreateCommandLineContext(args []string) (context *Context, error error) {
 	command := flags.String("c", "", "command to run")
 	commandParams := flags.String("p", "", "parameters for the command (JSON string)")
 	debug := flags.Bool("d", false, "debug mode")
+	unredacted := flags.Bool("u", false, "don't mask personal information in logs of the debug mode")
 
 	if err := flags.Parse(args); err != nil {
 		return nil, err
 	}
 
+	// Thunderbird starts the host with the path to the manifest file and
+	// the ID of the calling add-on.
+	var manifestPath, callerID string
+	if flags.NArg() > 0 {
+		manifestPath = flags.Arg(0)
+	}
+	if flags.NArg() > 1 {
+		callerID = flags.Arg(1)
+	}
+
 	return &Context{
 		ReportVersion: *reportVersion,
 		Command:       *command,
 		CommandParams: *commandParams,
 		Debug:         *debug,
+		Unredacted:    *unredacted,
+		ManifestPath:  manifestPath,
+		CallerID:      callerID,
 		Input:         os.Stdin,
 		Output:        os.Stdout,
 		ErrorOut:      os.Stderr,
@@ -124,124 +212,290 @@ func ProcessRequest(context *Context) error {
 	}
 	if context.Command != "" {
 		RunInCLI = true
+		LogFormat = LOG_FORMAT_TEXT
+		RedactLogs = !context.Unredacted
 		if context.Debug {
 			Logging = true
-			Debug = true
+			LogLevel = LOG_LEVEL_DEBUG
 		}
-		var err error
-		switch context.Command {
-		case "fetch":
-			if context.CommandParams == "" {
-				fmt.Fprintln(context.ErrorOut, `missing required params via -p option, like: -p "{\"path":\"c:\\path\\to\\file\"}"`)
-				return fmt.Errorf("missing params")
-			}
-			var params RequestParams
-			err := json.Unmarshal([]byte(context.CommandParams), &params)
-			if err != nil {
-				fmt.Fprintln(context.ErrorOut, "invalid params: "+fmt.Sprint(err))
-				return err
-			}
-			contents, errorMessage := Fetch(params.Path)
-			if errorMessage != "" {
-				return fmt.Errorf("failed to fetch: " + errorMessage)
-			}
-			fmt.Fprintln(context.Output, contents)
-		case "choose-file":
-			if context.CommandParams == "" {
-				fmt.Fprintln(context.ErrorOut, `missing required params via -p option, like: -p "{\"title\":\"dialog title\",\"role\":\"role\",\"fileName\":\"txt\",\"displayName\":\"name of the filter\",\"pattern\":\"matching file pattern\"}" (or simply: -p \"{}\")`)
-				return fmt.Errorf("missing params")
-			}
-			var params RequestParams
-			err := json.Unmarshal([]byte(context.CommandParams), &params)
-			if err != nil {
-				fmt.Fprintln(context.ErrorOut, "invalid params: "+fmt.Sprint(err))
+		return ProcessCLICommand(context)
+	}
+
+	return ProcessNativeMessages(context)
+}
+
+// Handles messages until the input is closed. An one-shot connection via
+// runtime.sendNativeMessage sends only one message and closes the input,
+// while a persistent connection via runtime.connectNative may send many.
+func ProcessNativeMessages(context *Context) error {
+	var rotateLog io.Closer
+	var loggingError error
+	defer func() {
+		if rotateLog != nil {
+			rotateLog.Close()
+		}
+	}()
+
+	for {
+		rawRequest, err := ReceiveNativeMessage(context.Input)
+		if err == io.EOF {
+			LogForDebug("Input is closed, exiting")
+			return nil
+		}
+		if err != nil && err != ErrRequestTooLarge {
+			return err
+		}
+		if err == nil && rawRequest == nil {
+			continue
+		}
+
+		var request *Request
+		if err == nil {
+			request, err = ParseRequest(rawRequest)
+		}
+		if err != nil {
+			// A malformed message must not close the persistent connection.
+			LogForWarn("Invalid request: " + err.Error())
+			response := NewErrorResponse(&HostError{Code: ERROR_CODE_INVALID_PARAMS, Message: "invalid request: " + err.Error()})
+			if err := PostResponse(response, false, context.Output); err != nil {
 				return err
 			}
-			path, errorMessage := ChooseFile(params)
-			if errorMessage != "" {
-				return fmt.Errorf("failed to open file chooser: " + errorMessage)
+			continue
+		}
+		request.CallerID = context.CallerID
+
+		Logging = request.Logging
+		LogLevel = GetRequestLogLevel(request)
+		LogFormat = GetRequestLogFormat(request)
+		RedactLogs = !request.Unredacted
+		SetSensitiveTerms(request.SensitiveTerms)
+		if Logging && rotateLog == nil && loggingError == nil {
+			rotateLog, loggingError = StartLogging(request)
+			if loggingError != nil {
+				// Requests should be handled even if logs cannot be written.
+				fmt.Fprintln(context.ErrorOut, "failed to start logging: "+RedactLogMessage(loggingError.Error()))
 			}
-			fmt.Fprintln(context.Output, path)
-		case "outlook-gpo-configs":
-			FetchOutlookGPOConfigsAndResponse(context.Output)
-		default:
-			fmt.Fprintln(context.ErrorOut, "unknown command: "+context.Command)
 		}
-		return err
+		if loggingError != nil {
+			Logging = false
+		}
+
+		if err := HandleRequest(request, context.Output); err != nil {
+			LogForError("Failed to handle " + request.Command + ": " + err.Error())
+			return err
+		}
+	}
+}
+
+// Requests are small JSON objects, so a larger length means a broken header.
+const MAX_REQUEST_SIZE = 4 * 1024 * 1024
+
+var ErrRequestTooLarge = fmt.Errorf("message is larger than %d bytes", MAX_REQUEST_SIZE)
+
+// Reads a message with its length header. Unlike chrome.Receive, this waits
+// for the whole message even if it arrives in small pieces via a pipe.
+func ReceiveNativeMessage(input io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(input, header); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header)
+	if length == 0 {
+		return nil, nil
+	}
+	if length > MAX_REQUEST_SIZE {
+		// Skip the body to keep reading following messages.
+		if _, err := io.CopyN(ioutil.Discard, input, int64(length)); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, ErrRequestTooLarge
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(input, message); err != nil {
+		return nil, err
 	}
+	return message, nil
+}
 
-	rawRequest, err := chrome.Receive(context.Input)
+func StartLogging(request *Request) (io.Closer, error) {
+	logfileDir, problems, err := ResolveLogDirectory(GetLogDirectoryCandidates(request))
+	if err != nil {
+		return nil, err
+	}
+	logRotationTime := time.Duration(request.LogRotationTime) * time.Hour
+	logRotationCount := request.LogRotationCount
+	maxAge := time.Duration(-1)
+	// for debugging
+	//logRotationTime = time.Duration(request.LogRotationTime) * time.Minute
+	rotateLog, err := rotatelogs.New(filepath.Join(logfileDir, LOG_FILE_NAME_PATTERN),
+		rotatelogs.WithMaxAge(maxAge),
+		rotatelogs.WithRotationTime(logRotationTime),
+		rotatelogs.WithRotationCount(logRotationCount),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	log.SetOutput(rotateLog)
+	log.SetFlags(log.Ldate | log.Ltime)
+	for _, problem := range problems {
+		LogForWarn("Falling back to another log directory: " + problem)
+	}
+	LogForDebug("logDirectory:" + logfileDir)
+	LogForDebug("logRotationCount:" + fmt.Sprint(logRotationCount))
+	LogForDebug("logRotationTime:" + fmt.Sprint(logRotationTime))
+	return rotateLog, nil
+}
+
+func ProcessCLICommand(context *Context) error {
+	command, found := Commands[context.Command]
+	if !found {
+		fmt.Fprintln(context.ErrorOut, "unknown command: "+context.Command)
+		PrintCommandsUsage(context.ErrorOut)
+		return fmt.Errorf("unknown command")
+	}
+	if context.CommandParams == "" && HasRequiredParams(command) {
+		fmt.Fprintln(context.ErrorOut, "missing required params via -p option, like: -p "+strconv.Quote(command.Example))
+		return fmt.Errorf("missing params")
+	}
+
+	request := &Request{Command: context.Command}
+	if context.CommandParams != "" {
+		request.RawParams = json.RawMessage(context.CommandParams)
+	}
+
+	response, err := DispatchRequest(request)
 	if err != nil {
 		return err
 	}
-	request := &Request{
-		Logging:          false,
-		Debug:            false,
-		LogRotationCount: 7,
-		LogRotationTime:  24,
+	if errorResponse, isError := response.(*ErrorResponse); isError {
+		fmt.Fprintln(context.ErrorOut, errorResponse.Error)
+		return errors.New(errorResponse.Error)
 	}
-	if err := json.Unmarshal(rawRequest, request); err != nil {
+	if warnable, isWarnable := response.(CLIWarnable); isWarnable {
+		for _, warning := range warnable.WarningsForCLI() {
+			fmt.Fprintln(context.ErrorOut, "warning: "+warning)
+		}
+	}
+	if printable, isPrintable := response.(CLIPrintable); isPrintable {
+		return printable.PrintForCLI(context.Output)
+	}
+	body, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
 		return err
 	}
+	fmt.Fprintln(context.Output, string(body))
+	return nil
+}
+
+func HandleRequest(request *Request, output io.Writer) error {
+	ResetDebugLogs()
+	CurrentLogContext = LogContext{Command: request.Command, CallerID: request.CallerID, RequestID: request.ID}
+	LogForInfo("Command:" + request.Command + " from " + request.CallerID)
+	LogForTrace("Params: " + string(request.RawParams))
+	if !RedactLogs {
+		LogForWarn("Personal information in logs is not redacted")
+	}
 
-	Logging = request.Logging
-	Debug = request.Debug
-	if Logging {
-		logfileDir := os.ExpandEnv(`${temp}`)
-		logRotationTime := time.Duration(request.LogRotationTime) * time.Hour
-		logRotationCount := request.LogRotationCount
-		maxAge := time.Duration(-1)
-		// for debugging
-		//logRotationTime = time.Duration(request.LogRotationTime) * time.Minute
-		rotateLog, err := rotatelogs.New(filepath.Join(logfileDir, "com.clear_code.flexible_confirm_mail_we_host.log.%Y%m%d%H%M.txt"),
-			rotatelogs.WithMaxAge(maxAge),
-			rotatelogs.WithRotationTime(logRotationTime),
-			rotatelogs.WithRotationCount(logRotationCount),
-		)
+	var response Response
+	if callerError := CheckCaller(request.CallerID); callerError != nil {
+		response = NewErrorResponse(callerError)
+	} else {
+		var err error
+		response, err = DispatchRequest(request)
 		if err != nil {
 			return err
 		}
-		defer rotateLog.Close()
-
-		log.SetOutput(rotateLog)
-		log.SetFlags(log.Ldate | log.Ltime)
-		LogForDebug("logRotationCount:" + fmt.Sprint(logRotationCount))
-		LogForDebug("logRotationTime:" + fmt.Sprint(logRotationTime))
 	}
+	response.Meta().ID = request.ID
+	if request.ReturnLogs {
+		response.Meta().Logs = DebugLogs
+		response.Meta().DroppedLogsCount = DroppedDebugLogsCount
+	}
+	return PostResponse(response, request.Chunked, output)
+}
+
+// Thunderbird rejects messages from the host larger than 1MB.
+const MAX_RESPONSE_SIZE = 1024 * 1024
 
-	LogForInfo("Command:" + request.Command)
+// Fetched contents may be larger than MAX_RESPONSE_SIZE and returned in
+// chunks, but endless contents must not be read into the memory.
+const MAX_DOWNLOAD_SIZE = 64 * 1024 * 1024
 
-	switch command := request.Command; command {
-	case "fetch":
-		err = FetchAndRespond(request.Params.Path, context.Output)
-	case "choose-file":
-		err = ChooseFileAndRespond(request.Params, context.Output)
-	case "outlook-gpo-configs":
-		err = FetchOutlookGPOConfigsAndResponse(context.Output)
-	default: // just echo
-		err = chrome.Post(rawRequest, context.Output)
+func NewTooLargeDownloadError(path string) *HostError {
+	LogForWarn("Too large contents: " + path)
+	return &HostError{
+		Code:    ERROR_CODE_TOO_LARGE,
+		Message: fmt.Sprintf("contents are larger than %d bytes", MAX_DOWNLOAD_SIZE),
+		Path:    path,
 	}
+}
 
-	return err
+func PostResponse(response Response, chunked bool, output io.Writer) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if len(body) > MAX_RESPONSE_SIZE && chunked {
+		return PostChunkedResponse(response.Meta().ID, body, output)
+	}
+	if len(body) > MAX_RESPONSE_SIZE {
+		LogForWarn("Too large response: " + fmt.Sprint(len(body)) + " bytes")
+		errorResponse := NewErrorResponse(&HostError{
+			Code:    ERROR_CODE_TOO_LARGE,
+			Message: "response is too large: " + fmt.Sprint(len(body)) + " bytes",
+		})
+		errorResponse.ID = response.Meta().ID
+		body, err = json.Marshal(errorResponse)
+		if err != nil {
+			return err
+		}
+	}
+	return chrome.Post(body, output)
 }
 
 type FetchResponse struct {
+	ResponseMeta
 	Contents string `json:"contents"`
+	Cached   bool   `json:"cached,omitempty"`   // the contents came from the cache for an URL
+	Encoding string `json:"encoding,omitempty"` // original encoding of the contents
 	Error    string `json:"error"`
 }
 
-func FetchAndRespond(path string, output io.Writer) error {
-	contents, errorMessage := Fetch(path)
-	response := &FetchResponse{contents, errorMessage}
-	body, err := json.Marshal(response)
-	if err != nil {
-		return err
+func (response *FetchResponse) PrintForCLI(output io.Writer) error {
+	if response.Error != "" {
+		return fmt.Errorf("failed to fetch: " + response.Error)
 	}
-	err = chrome.Post(body, output)
+	fmt.Fprintln(output, response.Contents)
+	return nil
+}
+
+func HandleFetch(request *Request) (Response, error) {
+	response := &FetchResponse{}
+	var err *HostError
+	response.Contents, response.Encoding, response.Cached, err = FetchContents(request.Params)
 	if err != nil {
-		return err
+		response.Error = err.Error()
+		response.ErrorDetail = err
 	}
-	return nil
+	return response, nil
+}
+
+// Reads a file or an URL and returns its contents as UTF-8.
+func FetchContents(params RequestParams) (contents string, encoding string, cached bool, hostError *HostError) {
+	if IsURL(params.Path) {
+		contents, cached, hostError = FetchURL(params.Path, params)
+	} else {
+		contents, hostError = Fetch(params.Path)
+	}
+	if hostError != nil {
+		return "", "", false, hostError
+	}
+	contents, encoding, hostError = DecodeContents([]byte(contents), params.Encoding)
+	if hostError != nil {
+		return "", "", false, hostError
+	}
+	return contents, encoding, cached, nil
 }
 
 func IsParentProcessDirKey(key string) bool {
@@ -317,63 +571,129 @@ func ExpandAllEnvVars(path string) string {
 	return path
 }
 
-func Fetch(path string) (contents string, errorMessage string) {
+func Fetch(path string) (contents string, hostError *HostError) {
 	pathWithExpandedParentProcessDir, err := ExpandParentProcessDir(path)
 	if err != nil {
-		return "", path + ": Failed to resolve parent process dir: " + err.Error()
+		return "", &HostError{
+			Code:    ERROR_CODE_INVALID_PATH,
+			Message: "Failed to resolve parent process dir: " + err.Error(),
+			Path:    path,
+		}
 	}
 
 	pathWithExpandedEnvVars := ExpandAllEnvVars(pathWithExpandedParentProcessDir)
 
-	buffer, err := ioutil.ReadFile(pathWithExpandedEnvVars)
+	if hostError := CheckFileAccess(path, pathWithExpandedEnvVars); hostError != nil {
+		return "", hostError
+	}
+
+	file, err := os.Open(pathWithExpandedEnvVars)
+	if err != nil {
+		return "", NewFileError(path, err)
+	}
+	defer file.Close()
+	buffer, err := ioutil.ReadAll(io.LimitReader(file, MAX_DOWNLOAD_SIZE+1))
 	if err != nil {
-		return "", path + ": " + err.Error()
+		return "", NewFileError(path, err)
+	}
+	if len(buffer) > MAX_DOWNLOAD_SIZE {
+		return "", NewTooLargeDownloadError(path)
 	}
-	return string(buffer), ""
+	return string(buffer), nil
 }
 
 type ChooseFileResponse struct {
-	Path  string `json:"path"`
-	Error string `json:"error"`
+	ResponseMeta
+	Path      string   `json:"path"`      // the first one of paths
+	Paths     []string `json:"paths"`     // all chosen paths
+	Cancelled bool     `json:"cancelled"` // not an error, for compatibility with old versions
+	Error     string   `json:"error"`
 }
 
-func ChooseFileAndRespond(params RequestParams, output io.Writer) error {
-	path, errorMessage := ChooseFile(params)
-	response := &ChooseFileResponse{path, errorMessage}
-	body, err := json.Marshal(response)
-	if err != nil {
-		return err
+func (response *ChooseFileResponse) PrintForCLI(output io.Writer) error {
+	if response.Error != "" {
+		return fmt.Errorf("failed to open file chooser: " + response.Error)
 	}
-	err = chrome.Post(body, output)
-	if err != nil {
-		return err
+	if response.Cancelled {
+		return fmt.Errorf("cancelled")
+	}
+	for _, path := range response.Paths {
+		fmt.Fprintln(output, path)
 	}
 	return nil
 }
 
-type TbStyleConfigs struct {
-	CountdownAllowSkip                      bool     `json:"CountdownAllowSkip"`
-	ShowCountdown                           bool     `json:"ShowCountdown"`
-	CountdownSeconds                        uint64   `json:"CountdownSeconds"`
-	SkipConfirmationForInternalMail         bool     `json:"SkipConfirmationForInternalMail"`
-	ConfirmMultipleRecipientDomains         bool     `json:"ConfirmMultipleRecipientDomains"`
-	MinConfirmMultipleRecipientDomainsCount uint64   `json:"MinConfirmMultipleRecipientDomainsCount"`
-	FixedInternalDomains                    []string `json:"FixedInternalDomains"`
-	BuiltInAttentionDomainsItems            []string `json:"BuiltInAttentionDomainsItems"`
-	BuiltInAttentionTermsItems              []string `json:"BuiltInAttentionTermsItems"`
-
-	HasCountdownAllowSkip                      bool `json:"HasCountdownAllowSkip"`
-	HasShowCountdown                           bool `json:"HasShowCountdown"`
-	HasCountdownSeconds                        bool `json:"HasCountdownSeconds"`
-	HasSkipConfirmationForInternalMail         bool `json:"HasSkipConfirmationForInternalMail"`
-	HasConfirmMultipleRecipientDomains         bool `json:"HasConfirmMultipleRecipientDomains"`
-	HasMinConfirmMultipleRecipientDomainsCount bool `json:"HasMinConfirmMultipleRecipientDomainsCount"`
-	HasFixedInternalDomains                    bool `json:"HasFixedInternalDomains"`
-	HasBuiltInAttentionDomainsItems            bool `json:"HasBuiltInAttentionDomainsItems"`
-	HasBuiltInAttentionTermsItems              bool `json:"HasBuiltInAttentionTermsItems"`
+func NewChooseFileResponse(paths []string, err *HostError) *ChooseFileResponse {
+	response := &ChooseFileResponse{Paths: paths}
+	if response.Paths == nil {
+		response.Paths = []string{}
+	}
+	if len(response.Paths) > 0 {
+		response.Path = response.Paths[0]
+	}
+	if err == nil {
+		return response
+	}
+	response.ErrorDetail = err
+	// Old versions returned just an empty path when cancelled.
+	if err.Code == ERROR_CODE_CANCELLED {
+		response.Cancelled = true
+		return response
+	}
+	response.Error = err.Error()
+	return response
+}
+
+func HandleChooseFile(request *Request) (Response, error) {
+	return NewChooseFileResponse(ChooseFile(request.Params)), nil
+}
+
+func HandleChooseSaveFile(request *Request) (Response, error) {
+	return NewChooseFileResponse(ChooseSaveFile(request.Params)), nil
+}
+
+func HandleChooseDirectory(request *Request) (Response, error) {
+	return NewChooseFileResponse(ChooseDirectory(request.Params)), nil
+}
+
+// Configs for FlexConfirmMail for Thunderbird, keyed by config names with
+// the first letter capitalized, like "ShowCountdown" for "showCountdown".
+// Each config is accompanied by a flag like "HasShowCountdown" in JSON.
+type TbStyleConfigs map[string]interface{}
+
+func (configs TbStyleConfigs) Has(key string) bool {
+	_, found := configs[key]
+	return found
+}
+
+func (configs TbStyleConfigs) MarshalJSON() ([]byte, error) {
+	flattened := map[string]interface{}{}
+	for key, value := range configs {
+		flattened[key] = value
+		flattened["Has"+key] = true
+	}
+	return json.Marshal(flattened)
 }
 
 type OutlookGPOConfigsResponse struct {
+	ResponseMeta
 	Default TbStyleConfigs `json:"Default"`
 	Locked  TbStyleConfigs `json:"Locked"`
+	// Where each config comes from, e.g. "HKLM" or the path to a policy file.
+	DefaultSources map[string]string `json:"DefaultSources,omitempty"`
+	LockedSources  map[string]string `json:"LockedSources,omitempty"`
+	// Broken sources skipped on reading, to tell why configs are missing.
+	Problems []string `json:"Problems,omitempty"`
+}
+
+func (response *OutlookGPOConfigsResponse) WarningsForCLI() []string {
+	return response.Problems
+}
+
+func HandleOutlookGPOConfigs(request *Request) (Response, error) {
+	response, err := ReadOutlookGPOConfigs()
+	if err != nil {
+		response.ErrorDetail = err
+	}
+	return &response, nil
 }
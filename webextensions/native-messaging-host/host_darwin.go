@@ -9,46 +9,46 @@
 package main
 
 import (
-	"encoding/json"
-	"github.com/lhside/chrome-go"
-	"github.com/ncruces/zenity"
-	"io"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-func ChooseFile(params RequestParams) (path string, errorMessage string) {
-	filename, err := zenity.SelectFile(
-		zenity.Title(params.Title),
-		zenity.Filename(params.FileName),
-		zenity.FileFilters{
-			{params.DisplayName, []string{params.Pattern}, true},
-		})
-	if err == zenity.ErrCanceled {
-		return filename, ""
-	} else if err != nil {
-		return "", err.Error()
-	}
-	return filename, ""
+var PlatformFeatures = map[string]bool{
+	"outlookGPOConfigs": true,
+	"chooseFile":        true,
+	"chooseSaveFile":    true,
+	"chooseDirectory":   true,
+	"parentProcessDir":  true,
 }
 
-func FetchOutlookGPOConfigsAndResponse(output io.Writer) error {
-	response := OutlookGPOConfigsResponse{}
+func ChooseFile(params RequestParams) (paths []string, hostError *HostError) {
+	return ChooseWithFileDialogs([]FileDialog{ZenityFileDialog{}}, FILE_DIALOG_MODE_OPEN, params)
+}
 
-	// NOT IMPLEMENTED YET
+func ChooseSaveFile(params RequestParams) (paths []string, hostError *HostError) {
+	return ChooseWithFileDialogs([]FileDialog{ZenityFileDialog{}}, FILE_DIALOG_MODE_SAVE, params)
+}
 
-	body, err := json.Marshal(response)
-	if err != nil {
-		return err
-	}
-	err = chrome.Post(body, output)
-	if err != nil {
-		return err
+func ChooseDirectory(params RequestParams) (paths []string, hostError *HostError) {
+	return ChooseWithFileDialogs([]FileDialog{ZenityFileDialog{}}, FILE_DIALOG_MODE_DIRECTORY, params)
+}
+
+// Overridable for testing.
+var ManagedPreferencesDir = "/Library/Managed Preferences"
+
+// Configuration profiles are installed as managed preferences, for the
+// computer and for each user.
+func OpenPolicySources() *PolicySources {
+	systemFile := filepath.Join(ManagedPreferencesDir, PLIST_POLICY_DOMAIN+".plist")
+	userFile := ""
+	if currentUser, err := user.Current(); err == nil {
+		userFile = filepath.Join(ManagedPreferencesDir, currentUser.Username, PLIST_POLICY_DOMAIN+".plist")
 	}
-	return nil
+	return OpenPlistPolicySources(systemFile, userFile)
 }
 
 func GetParentProcessBinPath() (string, error) {
@@ -63,6 +63,14 @@ func GetParentProcessBinPath() (string, error) {
 	return binPath, nil
 }
 
+func GetDefaultLogDirectories() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return []string{}
+	}
+	return []string{filepath.Join(home, "Library", "Logs", "FlexConfirmMail")}
+}
+
 func GetParentProcessDir() (string, error) {
 	binPath, err := GetParentProcessBinPath()
 	if err != nil {
@@ -79,3 +87,11 @@ func GetParentProcessDir() (string, error) {
 	dir := filepath.Dir(binPath)
 	return dir, nil
 }
+
+func ReadAccessPolicy() (*AccessPolicy, error) {
+	path, err := GetAccessPolicyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return ReadAccessPolicyFile(path)
+}
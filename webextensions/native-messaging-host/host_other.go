@@ -9,17 +9,70 @@
 package main
 
 import (
-	"io"
+	"os"
+	"path/filepath"
 )
 
-func ChooseFile(params RequestParams) (path string, errorMessage string) {
-	return "", ""
+var PlatformFeatures = map[string]bool{
+	"outlookGPOConfigs": true,
+	"chooseFile":        true,
+	"chooseSaveFile":    true,
+	"chooseDirectory":   true,
+	"parentProcessDir":  false,
 }
 
-func FetchOutlookGPOConfigsAndResponse(output io.Writer) error {
-	return nil
+func ChooseFile(params RequestParams) (paths []string, hostError *HostError) {
+	return ChooseWithFileDialogs(FileDialogs, FILE_DIALOG_MODE_OPEN, params)
+}
+
+func ChooseSaveFile(params RequestParams) (paths []string, hostError *HostError) {
+	return ChooseWithFileDialogs(FileDialogs, FILE_DIALOG_MODE_SAVE, params)
+}
+
+func ChooseDirectory(params RequestParams) (paths []string, hostError *HostError) {
+	return ChooseWithFileDialogs(FileDialogs, FILE_DIALOG_MODE_DIRECTORY, params)
+}
+
+// Overridable for testing.
+var SystemPolicyDir = "/etc/flexconfirmmail/policies.d"
+var UserPolicyFile = ""
+
+func GetUserPolicyFile() string {
+	if UserPolicyFile != "" {
+		return UserPolicyFile
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "flexconfirmmail", "policies.json")
+}
+
+func OpenPolicySources() *PolicySources {
+	return OpenJSONPolicySources(SystemPolicyDir, GetUserPolicyFile())
+}
+
+// Logs are state data in the XDG Base Directory Specification.
+func GetDefaultLogDirectories() []string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return []string{}
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return []string{filepath.Join(stateHome, "flexconfirmmail")}
 }
 
 func GetParentProcessDir() (string, error) {
 	return "", nil
 }
+
+func ReadAccessPolicy() (*AccessPolicy, error) {
+	path, err := GetAccessPolicyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return ReadAccessPolicyFile(path)
+}
@@ -8,12 +8,16 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -111,7 +115,8 @@ func TestFetch_Missing(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "", errorOut.String())
 
-	assert.Equal(t, `{"contents":"","error":"`+path+`: open `+path+`: no such file or directory"}`, ReadOutput(&output))
+	assert.Equal(t, `{"errorDetail":{"code":"not_found","message":"open `+path+`: no such file or directory","path":"`+path+`"},`+
+		`"contents":"","error":"`+path+`: open `+path+`: no such file or directory"}`, ReadOutput(&output))
 }
 
 func TestFetch_Success(t *testing.T) {
@@ -141,7 +146,7 @@ func TestFetch_Success(t *testing.T) {
 	escapedContents := strings.ReplaceAll(
 		strings.ReplaceAll(string(fileContents), `"`, `\"`),
 		"\n", `\n`)
-	assert.Equal(t, `{"contents":"`+escapedContents+`","error":""}`, ReadOutput(&output))
+	assert.Equal(t, `{"contents":"`+escapedContents+`","encoding":"utf-8","error":""}`, ReadOutput(&output))
 }
 
 func CreateTempFileToFetch(t *testing.T, dir, name, content string) string {
@@ -194,10 +199,10 @@ func TestFetch_EnvironmentVariableExpansion(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			contents, errMsg := Fetch(c.path)
+			contents, err := Fetch(c.path)
 
-			if errMsg != "" {
-				t.Fatalf("unexpected error: %s", errMsg)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
 			}
 
 			if contents != expected {
@@ -205,4 +210,327 @@ func TestFetch_EnvironmentVariableExpansion(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPersistentConnection(t *testing.T) {
+	wd, _ := os.Getwd()
+	path := filepath.Join(wd, "missing.txt")
+	var input bytes.Buffer
+	for _, id := range []string{`1`, `"second"`} {
+		message, _ := ioutil.ReadAll(CreateInput(`{` +
+			`"id":` + id + `,` +
+			`"command":"fetch",` +
+			`"params":{"path":"` + path + `"}` +
+			`}`))
+		input.Write(message)
+	}
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    &input,
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+	assert.Equal(t, "", errorOut.String())
+
+	expectedError := `"errorDetail":{"code":"not_found","message":"open ` + path + `: no such file or directory","path":"` + path + `"},` +
+		`"contents":"","error":"` + path + `: open ` + path + `: no such file or directory"}`
+	assert.Equal(t, `{"id":1,`+expectedError, ReadOutput(&output))
+	assert.Equal(t, `{"id":"second",`+expectedError, ReadOutput(&output))
+	assert.Equal(t, "", ReadOutput(&output))
+}
+
+func TestUnknownCommand(t *testing.T) {
+	input := CreateInput(`{"id":1,"command":"unknown"}`)
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    input,
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":1,"errorDetail":{"code":"unknown_command","message":"unknown command: unknown"},"error":"unknown command: unknown"}`, ReadOutput(&output))
+}
+
+func TestInvalidParams(t *testing.T) {
+	input := CreateInput(`{"command":"fetch","params":{"path":true}}`)
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    input,
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"errorDetail":{"code":"invalid_params","message":"invalid params: param path must be string but boolean","param":"path"},"error":"invalid params: param path must be string but boolean"}`, ReadOutput(&output))
+}
+
+func TestCapabilities(t *testing.T) {
+	input := CreateInput(`{"command":"capabilities"}`)
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    input,
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+
+	var response CapabilitiesResponse
+	err = json.Unmarshal([]byte(ReadOutput(&output)), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, VERSION, response.Version)
+	assert.Equal(t, PROTOCOL_VERSION, response.ProtocolVersion)
+	assert.Equal(t, runtime.GOOS, response.OS)
+	assert.True(t, response.Features["persistentConnection"])
+	names := []string{}
+	for _, command := range response.Commands {
+		names = append(names, command.Name)
+	}
+	assert.Contains(t, names, "fetch")
+	assert.Contains(t, names, "capabilities")
+}
+
+func TestFetch_TooLarge(t *testing.T) {
+	contents := strings.Repeat("日本語\"<>&\n", 100*1024)
+	path := CreateTempFileToFetch(t, t.TempDir(), "large.txt", contents)
+	fetchMessage := `"command":"fetch","params":{"path":"` + path + `"}`
+
+	t.Run("not chunked", func(t *testing.T) {
+		var output bytes.Buffer
+		context := &Context{
+			Input:    CreateInput(`{` + fetchMessage + `}`),
+			Output:   &output,
+			ErrorOut: &bytes.Buffer{},
+		}
+		err := ProcessRequest(context)
+		assert.NoError(t, err)
+
+		var response ErrorResponse
+		err = json.Unmarshal([]byte(ReadOutput(&output)), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, ERROR_CODE_TOO_LARGE, response.ErrorDetail.Code)
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		var output bytes.Buffer
+		context := &Context{
+			Input:    CreateInput(`{"id":"large","chunked":true,` + fetchMessage + `}`),
+			Output:   &output,
+			ErrorOut: &bytes.Buffer{},
+		}
+		err := ProcessRequest(context)
+		assert.NoError(t, err)
+
+		var body strings.Builder
+		var checksum string
+		for index := 0; ; index++ {
+			message := ReadOutput(&output)
+			if message == "" {
+				break
+			}
+			assert.LessOrEqual(t, len(message), MAX_RESPONSE_SIZE)
+			var chunk ChunkResponse
+			err = json.Unmarshal([]byte(message), &chunk)
+			assert.NoError(t, err)
+			assert.Equal(t, `"large"`, string(chunk.ID))
+			assert.Equal(t, index, chunk.Chunk.Index)
+			body.WriteString(chunk.Chunk.Data)
+			checksum = chunk.Chunk.Checksum
+		}
+		sum := sha256.Sum256([]byte(body.String()))
+		assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), checksum)
+
+		var response FetchResponse
+		err = json.Unmarshal([]byte(body.String()), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, contents, response.Contents)
+	})
+
+	t.Run("over download limit", func(t *testing.T) {
+		hugePath := filepath.Join(t.TempDir(), "huge.txt")
+		file, err := os.Create(hugePath)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Truncate(MAX_DOWNLOAD_SIZE+1))
+		file.Close()
+
+		_, hostError := Fetch(hugePath)
+		if assert.NotNil(t, hostError) {
+			assert.Equal(t, ERROR_CODE_TOO_LARGE, hostError.Code)
+			assert.Equal(t, hugePath, hostError.Path)
+		}
+	})
+}
+
+func TestCreateCommandLineContext_CallerID(t *testing.T) {
+	context, err := CreateCommandLineContext([]string{
+		"/path/to/com.clear_code.flexible_confirm_mail_we_host.json",
+		"flexible-confirm-mail@clear-code.com",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/path/to/com.clear_code.flexible_confirm_mail_we_host.json", context.ManifestPath)
+	assert.Equal(t, "flexible-confirm-mail@clear-code.com", context.CallerID)
+}
+
+func TestCallerVerification(t *testing.T) {
+	cases := []struct {
+		callerID string
+		allowed  bool
+	}{
+		{"", true},
+		{"flexible-confirm-mail@clear-code.com", true},
+		{"flexible-confirm-mail-progressive@clear-code.com", true},
+		{"malicious@example.com", false},
+	}
+	for _, c := range cases {
+		t.Run(c.callerID, func(t *testing.T) {
+			var output bytes.Buffer
+			context := &Context{
+				CallerID: c.callerID,
+				Input:    CreateInput(`{"command":"capabilities"}`),
+				Output:   &output,
+				ErrorOut: &bytes.Buffer{},
+			}
+			err := ProcessRequest(context)
+			assert.NoError(t, err)
+
+			var response CapabilitiesResponse
+			err = json.Unmarshal([]byte(ReadOutput(&output)), &response)
+			assert.NoError(t, err)
+			if c.allowed {
+				assert.Nil(t, response.ErrorDetail)
+				assert.Equal(t, c.callerID, response.CallerID)
+			} else if assert.NotNil(t, response.ErrorDetail) {
+				assert.Equal(t, ERROR_CODE_CALLER_NOT_ALLOWED, response.ErrorDetail.Code)
+			}
+		})
+	}
+
+	UseAccessPolicy(t, &AccessPolicy{CallerIDs: []string{"custom@example.com"}})
+	assert.Nil(t, CheckCaller("custom@example.com"))
+	assert.NotNil(t, CheckCaller("flexible-confirm-mail@clear-code.com"))
+}
+
+func TestReturnLogs(t *testing.T) {
+	var input bytes.Buffer
+	for _, returnLogs := range []string{`true`, `false`} {
+		message, _ := ioutil.ReadAll(CreateInput(`{"id":"req-1","command":"unknown","returnLogs":` + returnLogs + `}`))
+		input.Write(message)
+	}
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    &input,
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+
+	var response struct {
+		Logs []LogEntry `json:"logs"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(ReadOutput(&output)), &response))
+	messages := []string{}
+	for _, entry := range response.Logs {
+		assert.Equal(t, "unknown", entry.Command)
+		assert.Equal(t, `"req-1"`, string(entry.RequestID))
+		messages = append(messages, "["+entry.Level+"] "+entry.Message)
+	}
+	assert.Equal(t, []string{"[info] Command:unknown from ", "[trace] Params: ", "[warn] Unknown command: unknown"}, messages)
+
+	assert.NotContains(t, ReadOutput(&output), `"logs"`)
+}
+
+// Reads at most 3 bytes at once, like a pipe delivering a large message in
+// pieces.
+type SmallChunksReader struct {
+	reader io.Reader
+}
+
+func (chunks *SmallChunksReader) Read(buffer []byte) (int, error) {
+	if len(buffer) > 3 {
+		buffer = buffer[:3]
+	}
+	return chunks.reader.Read(buffer)
+}
+
+func TestPersistentConnection_SmallChunks(t *testing.T) {
+	var input bytes.Buffer
+	padding := strings.Repeat("x", 100000)
+	for _, id := range []string{`1`, `2`} {
+		message, _ := ioutil.ReadAll(CreateInput(`{"id":` + id + `,"command":"unknown","params":{"padding":"` + padding + `"}}`))
+		input.Write(message)
+	}
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    &SmallChunksReader{&input},
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+	assert.Contains(t, ReadOutput(&output), `{"id":1,"errorDetail":{"code":"unknown_command"`)
+	assert.Contains(t, ReadOutput(&output), `{"id":2,"errorDetail":{"code":"unknown_command"`)
+	assert.Equal(t, "", ReadOutput(&output))
+}
+
+func TestPersistentConnection_MalformedRequest(t *testing.T) {
+	var input bytes.Buffer
+	for _, message := range []string{`{"id":1,"command":`, `{"id":2,"command":"unknown"}`} {
+		raw, _ := ioutil.ReadAll(CreateInput(message))
+		input.Write(raw)
+	}
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Input:    &input,
+		Output:   &output,
+		ErrorOut: &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"errorDetail":{"code":"invalid_params","message":"invalid request: unexpected end of JSON input"},"error":"invalid request: unexpected end of JSON input"}`, ReadOutput(&output))
+	assert.Contains(t, ReadOutput(&output), `{"id":2,"errorDetail":{"code":"unknown_command"`)
+}
+
+func TestReceiveNativeMessage_Truncated(t *testing.T) {
+	message, _ := ioutil.ReadAll(CreateInput(`{"command":"unknown"}`))
+	_, err := ReceiveNativeMessage(bytes.NewReader(message[:10]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = ReceiveNativeMessage(bytes.NewReader(nil))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReceiveNativeMessage_TooLarge(t *testing.T) {
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, 0xFFFFFFFF)
+	_, err := ReceiveNativeMessage(bytes.NewReader(header))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	var input bytes.Buffer
+	binary.LittleEndian.PutUint32(header, MAX_REQUEST_SIZE+1)
+	input.Write(header)
+	input.Write(bytes.Repeat([]byte(" "), MAX_REQUEST_SIZE+1))
+	next, _ := ioutil.ReadAll(CreateInput(`{"command":"unknown"}`))
+	input.Write(next)
+	_, err = ReceiveNativeMessage(&input)
+	assert.Equal(t, ErrRequestTooLarge, err)
+	message, err := ReceiveNativeMessage(&input)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"command":"unknown"}`, string(message))
+}
@@ -9,24 +9,33 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/lhside/chrome-go"
+	"github.com/harry1453/go-common-file-dialog/cfd"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
-	"io"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
-	"strings"
 	"syscall"
 	"unsafe"
 )
 
 var (
-	comdlg32              = syscall.NewLazyDLL("comdlg32.dll")
-	ProcGetOpenFileNameW  = comdlg32.NewProc("GetOpenFileNameW")
+	comdlg32                 = syscall.NewLazyDLL("comdlg32.dll")
+	ProcGetOpenFileNameW     = comdlg32.NewProc("GetOpenFileNameW")
+	ProcCommDlgExtendedError = comdlg32.NewProc("CommDlgExtendedError")
 )
 
+var PlatformFeatures = map[string]bool{
+	"outlookGPOConfigs": true,
+	"chooseFile":        true,
+	"chooseSaveFile":    true,
+	"chooseDirectory":   true,
+	"parentProcessDir":  true,
+}
+
 type OpenFileNameW struct {
 	lStructSize       uint32
 	hwndOwner         uintptr
@@ -57,8 +66,12 @@ const (
 	OFN_EXPLORER         = 0x00080000
 	OFN_FILEMUSTEXIST    = 0x00001000
 	OFN_PATHMUSTEXIST    = 0x00000800
+	OFN_ALLOWMULTISELECT = 0x00000200
 )
 
+// Enough for multiple long paths beyond MAX_PATH.
+const CHOOSE_FILE_BUFFER_LENGTH = 65536
+
 func Utf16Ptr(s string) *uint16 {
 	if s == "" {
 		return nil
@@ -77,8 +90,8 @@ func BuildFilter(displayName, pattern string) *uint16 {
 	return ptr
 }
 
-func ChooseFile(params RequestParams) (path string, errorMessage string) {
-	buf := make([]uint16, syscall.MAX_PATH)
+func ChooseFile(params RequestParams) (paths []string, hostError *HostError) {
+	buf := make([]uint16, CHOOSE_FILE_BUFFER_LENGTH)
 
 	LogForDebug("ChooseFile, filename = " + params.FileName)
 	if params.FileName != "" {
@@ -95,120 +108,179 @@ func ChooseFile(params RequestParams) (path string, errorMessage string) {
 		nMaxFile:        uint32(len(buf)),
 		flags:           OFN_EXPLORER | OFN_FILEMUSTEXIST | OFN_PATHMUSTEXIST,
 	}
+	if params.Multiple {
+		ofn.flags |= OFN_ALLOWMULTISELECT
+	}
 
 	ret, _, err := ProcGetOpenFileNameW.Call(uintptr(unsafe.Pointer(&ofn)))
 	if ret == 0 {
-		LogForDebug("Canceled or failed: " + err.Error())
-		return "", err.Error()
+		// CommDlgExtendedError returns 0 if the user just canceled the dialog.
+		code, _, _ := ProcCommDlgExtendedError.Call()
+		if code == 0 {
+			LogForDebug("Canceled")
+			return nil, &HostError{Code: ERROR_CODE_CANCELLED, Message: "cancelled"}
+		}
+		LogForDebug("Failed: " + err.Error() + " (" + strconv.FormatUint(uint64(code), 16) + ")")
+		return nil, &HostError{Code: ERROR_CODE_DIALOG, Message: err.Error()}
 	}
 
-	return syscall.UTF16ToString(buf), ""
-}
-
-func ReadIntegerRegValue(key registry.Key, valueName string) (data uint64, errorMessage string) {
-	data, _, err := key.GetIntegerValue(valueName)
-	if err != nil {
-		LogForDebug("Failed to get data of the value " + valueName)
-		return 0, err.Error()
+	if params.Multiple {
+		return ParseOpenFileNameResult(buf), nil
 	}
-	LogForDebug("Successfully got data of the value " + valueName + ": " + strconv.FormatUint(data, 10))
-	return data, ""
+	return []string{syscall.UTF16ToString(buf)}, nil
 }
 
-func ReadStringsRegValue(key registry.Key, valueName string) (data []string, errorMessage string) {
-	data, _, err := key.GetStringsValue(valueName)
-	if err != nil {
-		LogForDebug("Failed to get data of the value " + valueName)
-		return data, err.Error()
+// Dialogs other than the open file dialog are the common item dialog.
+func NewCommonItemDialogConfig(params RequestParams, role string) cfd.DialogConfig {
+	config := cfd.DialogConfig{
+		Title: params.Title,
+		// The title is applied only with a role.
+		Role:             role,
+		Folder:           params.Path,
+		FileName:         params.FileName,
+		DefaultExtension: params.DefaultExtension,
+	}
+	if params.DisplayName != "" && params.Pattern != "" {
+		config.FileFilters = []cfd.FileFilter{
+			{DisplayName: fmt.Sprintf("%s (%s)", params.DisplayName, params.Pattern), Pattern: params.Pattern},
+		}
 	}
-	LogForDebug("Successfully got data of the value " + valueName + ": " + strings.Join(data, " "))
-	return data, ""
+	return config
 }
 
-func ReadAndApplyOutlookGPOConfigs(base registry.Key, keyPath string, configs *TbStyleConfigs) error {
-	key, err := registry.OpenKey(base,
-		keyPath,
-		registry.QUERY_VALUE)
-	if err != nil {
-		LogForDebug("Failed to open key " + keyPath)
-		return err
+// The common item dialog is a COM object, so it must be created and shown in
+// a thread initialized for COM.
+func ShowCommonItemDialog(newDialog func() (cfd.Dialog, error)) ([]string, *HostError) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// S_FALSE means that the thread is already initialized, and it still
+	// needs to be uninitialized.
+	if err := windows.CoInitializeEx(0, windows.COINIT_APARTMENTTHREADED|windows.COINIT_DISABLE_OLE1DDE); err != nil && err != syscall.Errno(windows.S_FALSE) {
+		LogForDebug("Failed to initialize COM: " + err.Error())
+		return nil, &HostError{Code: ERROR_CODE_DIALOG, Message: err.Error()}
 	}
-	defer key.Close()
+	defer windows.CoUninitialize()
 
-	countAllowSkip, errMsg := ReadIntegerRegValue(key, "CountAllowSkip")
-	if errMsg == "" {
-		configs.CountdownAllowSkip = countAllowSkip == 1
-		configs.HasCountdownAllowSkip = true
-	}
-	countEnabled, errMsg := ReadIntegerRegValue(key, "CountEnabled")
-	if errMsg == "" {
-		configs.ShowCountdown = countEnabled == 1
-		configs.HasShowCountdown = true
-	}
-	countSeconds, errMsg := ReadIntegerRegValue(key, "CountSeconds")
-	if errMsg == "" {
-		configs.CountdownSeconds = countSeconds
-		configs.HasCountdownSeconds = true
-	}
-	mainSkipIfNoExt, errMsg := ReadIntegerRegValue(key, "MainSkipIfNoExt")
-	if errMsg == "" {
-		configs.SkipConfirmationForInternalMail = mainSkipIfNoExt == 1
-		configs.HasSkipConfirmationForInternalMail = true
-	}
-	safeBccEnabled, errMsg := ReadIntegerRegValue(key, "SafeBccEnabled")
-	if errMsg == "" {
-		configs.ConfirmMultipleRecipientDomains = safeBccEnabled == 1
-		configs.HasConfirmMultipleRecipientDomains = true
-	}
-	safeBccThreshold, errMsg := ReadIntegerRegValue(key, "SafeBccThreshold")
-	if errMsg == "" {
-		configs.MinConfirmMultipleRecipientDomainsCount = safeBccThreshold
-		configs.HasMinConfirmMultipleRecipientDomainsCount = true
-	}
-	trustedDomains, errMsg := ReadStringsRegValue(key, "TrustedDomains")
-	if errMsg == "" {
-		configs.FixedInternalDomains = trustedDomains
-		configs.HasFixedInternalDomains = true
+	dialog, err := newDialog()
+	if err != nil {
+		LogForDebug("Failed to create dialog: " + err.Error())
+		return nil, &HostError{Code: ERROR_CODE_DIALOG, Message: err.Error()}
 	}
-	unsafeDomains, errMsg := ReadStringsRegValue(key, "UnsafeDomains")
-	if errMsg == "" {
-		configs.BuiltInAttentionDomainsItems = unsafeDomains
-		configs.HasBuiltInAttentionDomainsItems = true
+	defer dialog.Release()
+	path, err := dialog.ShowAndGetResult()
+	if err == cfd.ErrorCancelled {
+		LogForDebug("Canceled")
+		return nil, &HostError{Code: ERROR_CODE_CANCELLED, Message: "cancelled"}
 	}
-	unsafeFiles, errMsg := ReadStringsRegValue(key, "UnsafeFiles")
-	if errMsg == "" {
-		configs.BuiltInAttentionTermsItems = unsafeFiles
-		configs.HasBuiltInAttentionTermsItems = true
+	if err != nil {
+		LogForDebug("Failed: " + err.Error())
+		return nil, &HostError{Code: ERROR_CODE_DIALOG, Message: err.Error()}
 	}
-	return nil
+	return []string{path}, nil
+}
+
+func ChooseSaveFile(params RequestParams) (paths []string, hostError *HostError) {
+	LogForDebug("ChooseSaveFile, filename = " + params.FileName)
+	return ShowCommonItemDialog(func() (cfd.Dialog, error) {
+		dialog, err := cfd.NewSaveFileDialog(NewCommonItemDialogConfig(params, "FlexConfirmMailSaveFile"))
+		return dialog, err
+	})
+}
+
+func ChooseDirectory(params RequestParams) (paths []string, hostError *HostError) {
+	LogForDebug("ChooseDirectory, path = " + params.Path)
+	return ShowCommonItemDialog(func() (cfd.Dialog, error) {
+		dialog, err := cfd.NewSelectFolderDialog(NewCommonItemDialogConfig(params, "FlexConfirmMailDirectory"))
+		return dialog, err
+	})
+}
+
+type RegistryPolicyValues struct {
+	Key registry.Key
 }
 
-func FetchOutlookGPOConfigsAndResponse(output io.Writer) error {
-	response := OutlookGPOConfigsResponse{}
+func (values *RegistryPolicyValues) GetIntegerValue(name string) (uint64, error) {
+	data, _, err := values.Key.GetIntegerValue(name)
+	return data, NormalizeRegistryError(err)
+}
 
-	defaultKeyPath := `SOFTWARE\Policies\FlexConfirmMail\Default`
-	LogForDebug(`Read GPO configs from HKLM\` + defaultKeyPath)
-	ReadAndApplyOutlookGPOConfigs(registry.LOCAL_MACHINE, defaultKeyPath, &response.Default)
-	LogForDebug(`Read GPO configs from HKCU\` + defaultKeyPath)
-	ReadAndApplyOutlookGPOConfigs(registry.CURRENT_USER, defaultKeyPath, &response.Default)
+func (values *RegistryPolicyValues) GetStringValue(name string) (string, error) {
+	data, _, err := values.Key.GetStringValue(name)
+	return data, NormalizeRegistryError(err)
+}
 
-	/*
-		lockedKeyPath := `SOFTWARE\Policies\FlexConfirmMail\Locked`
-		LogForDebug(`Read GPO configs from HKLM\` + lockedKeyPath)
-		ReadAndApplyOutlookGPOConfigs(registry.LOCAL_MACHINE, lockedKeyPath, &response.Locked)
-		LogForDebug(`Read GPO configs from HKCU\` + lockedKeyPath)
-		ReadAndApplyOutlookGPOConfigs(registry.CURRENT_USER, lockedKeyPath, &response.Locked)
-	*/
+func (values *RegistryPolicyValues) GetStringsValue(name string) ([]string, error) {
+	data, _, err := values.Key.GetStringsValue(name)
+	return data, NormalizeRegistryError(err)
+}
 
-	body, err := json.Marshal(response)
+func (values *RegistryPolicyValues) ListPolicyValues() ([]PolicyValueInfo, error) {
+	names, err := values.Key.ReadValueNames(0)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	sort.Strings(names)
+	infos := []PolicyValueInfo{}
+	for _, name := range names {
+		_, valueType, err := values.Key.GetValue(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		var data interface{}
+		switch valueType {
+		case registry.SZ, registry.EXPAND_SZ:
+			data, _, err = values.Key.GetStringValue(name)
+		case registry.DWORD, registry.QWORD:
+			data, _, err = values.Key.GetIntegerValue(name)
+		case registry.MULTI_SZ:
+			data, _, err = values.Key.GetStringsValue(name)
+		default:
+			data, _, err = values.Key.GetBinaryValue(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, PolicyValueInfo{name, RegistryValueTypeName(valueType), data})
+	}
+	return infos, nil
+}
+
+func (values *RegistryPolicyValues) Close() error {
+	return values.Key.Close()
+}
+
+type WindowsRegistry struct{}
+
+func (windowsRegistry WindowsRegistry) OpenKey(hive string, path string) (RegistryKey, error) {
+	base := registry.CURRENT_USER
+	if NormalizeRegistryHive(hive) == REGISTRY_HIVE_LOCAL_MACHINE {
+		base = registry.LOCAL_MACHINE
 	}
-	err = chrome.Post(body, output)
+	key, err := registry.OpenKey(base, path, registry.QUERY_VALUE)
 	if err != nil {
-		return err
+		return nil, NormalizeRegistryError(err)
 	}
-	return nil
+	return &RegistryPolicyValues{key}, nil
+}
+
+// Errors of the registry package are converted to ones shared with
+// MemoryRegistry.
+func NormalizeRegistryError(err error) error {
+	switch err {
+	case registry.ErrNotExist:
+		return ErrRegistryNotExist
+	case registry.ErrUnexpectedType:
+		return ErrRegistryUnexpectedType
+	}
+	return err
+}
+
+func OpenPolicySources() *PolicySources {
+	return OpenRegistryPolicySources(WindowsRegistry{})
+}
+
+func ReadAccessPolicy() (*AccessPolicy, error) {
+	return ReadRegistryAccessPolicy(WindowsRegistry{})
 }
 
 func GetParentProcessExePath() (string, error) {
@@ -262,6 +334,18 @@ func GetParentProcessExePath() (string, error) {
 	return windows.UTF16ToString(buf[:size]), nil
 }
 
+// %TEMP% is the traditional location of logs.
+func GetDefaultLogDirectories() []string {
+	dirs := []string{}
+	if temp := os.Getenv("TEMP"); temp != "" {
+		dirs = append(dirs, temp)
+	}
+	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+		dirs = append(dirs, filepath.Join(localAppData, "FlexConfirmMail", "logs"))
+	}
+	return dirs
+}
+
 func GetParentProcessDir() (string, error) {
 	exePath, err := GetParentProcessExePath()
 	if err != nil {
@@ -0,0 +1,283 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Same to CONFIGS_VERSION in background.js.
+const TB_CONFIGS_VERSION = 3
+
+const OUTLOOK_COMMON_CONFIG_FILE_NAME = "Common.txt"
+
+// Mappings from configs of FlexConfirmMail for Outlook to configs of
+// FlexConfirmMail for Thunderbird.
+var OutlookConfigMappings = []PolicyMapping{
+	{"CountAllowSkip", "countdownAllowSkip", POLICY_TYPE_BOOL},
+	{"CountEnabled", "showCountdown", POLICY_TYPE_BOOL},
+	{"CountSeconds", "countdownSeconds", POLICY_TYPE_INTEGER},
+	{"MainSkipIfNoExt", "skipConfirmationForInternalMail", POLICY_TYPE_BOOL},
+	{"SafeBccEnabled", "confirmMultipleRecipientDomains", POLICY_TYPE_BOOL},
+	{"SafeBccThreshold", "minConfirmMultipleRecipientDomainsCount", POLICY_TYPE_INTEGER},
+	{"TrustedDomains", "internalDomains", POLICY_TYPE_STRINGS},
+}
+
+// Lists imported as items of built-in rules.
+var OutlookRuleMappings = []struct {
+	Name   string
+	RuleID string
+}{
+	{"UnsafeDomains", "builtInAttentionDomains"},
+	{"UnsafeFiles", "builtInAttentionTerms"},
+}
+
+type ImportOutlookConfigResponse struct {
+	ResponseMeta
+	Configs     map[string]interface{} `json:"configs"`
+	Unsupported []string               `json:"unsupported"`
+	Error       string                 `json:"error"`
+}
+
+func (response *ImportOutlookConfigResponse) WarningsForCLI() []string {
+	return response.Unsupported
+}
+
+func (response *ImportOutlookConfigResponse) PrintForCLI(output io.Writer) error {
+	if response.Error != "" {
+		return fmt.Errorf("failed to import: " + response.Error)
+	}
+	body, err := json.MarshalIndent(response.Configs, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output, string(body))
+	return nil
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name: "import-outlook-config",
+		Params: []CommandParam{
+			{"path", "string", true, "path to a .reg file, or the config directory (or its Common.txt) of FlexConfirmMail for Outlook"},
+		},
+		Help:    "convert configs of FlexConfirmMail for Outlook to configs for Thunderbird",
+		Example: `{"path":"%APPDATA%\\FlexConfirmMail"}`,
+		Handler: HandleImportOutlookConfig,
+	})
+}
+
+func HandleImportOutlookConfig(request *Request) (Response, error) {
+	response := &ImportOutlookConfigResponse{Configs: map[string]interface{}{}, Unsupported: []string{}}
+	values, skipped, err := LoadOutlookConfigValues(request.Params.Path)
+	if err != nil {
+		response.Error = err.Error()
+		response.ErrorDetail = err
+		return response, nil
+	}
+	response.Configs, response.Unsupported = ConvertOutlookConfigs(values)
+	response.Unsupported = append(skipped, response.Unsupported...)
+	return response, nil
+}
+
+// Returns values and descriptions of skipped files.
+func LoadOutlookConfigValues(path string) (*MemoryRegistryKey, []string, *HostError) {
+	expanded := ExpandAllEnvVars(path)
+	if hostError := CheckFileAccess(path, expanded); hostError != nil {
+		return nil, nil, hostError
+	}
+	info, err := os.Stat(expanded)
+	if err != nil {
+		return nil, nil, NewFileError(path, err)
+	}
+	if info.IsDir() {
+		return ReadOutlookConfigDir(expanded)
+	}
+	if strings.EqualFold(filepath.Ext(expanded), ".reg") {
+		registry, err := LoadRegFile(expanded)
+		if err != nil {
+			return nil, nil, &HostError{Code: ERROR_CODE_INVALID_PATH, Message: err.Error(), Path: path}
+		}
+		values, hostError := CollectOutlookConfigValues(registry, path)
+		return values, []string{}, hostError
+	}
+	return ReadOutlookConfigDir(filepath.Dir(expanded))
+}
+
+// Values are collected like users see them: HKCU overrides HKLM for
+// Default, and HKLM overrides HKCU for Locked.
+func CollectOutlookConfigValues(registry *MemoryRegistry, path string) (*MemoryRegistryKey, *HostError) {
+	candidates := []struct {
+		hive    string
+		keyPath string
+	}{
+		{REGISTRY_HIVE_LOCAL_MACHINE, REGISTRY_POLICY_KEY_PATH + `\Default`},
+		{REGISTRY_HIVE_CURRENT_USER, REGISTRY_POLICY_KEY_PATH + `\Default`},
+		{REGISTRY_HIVE_CURRENT_USER, REGISTRY_POLICY_KEY_PATH + `\Locked`},
+		{REGISTRY_HIVE_LOCAL_MACHINE, REGISTRY_POLICY_KEY_PATH + `\Locked`},
+	}
+	values := NewMemoryRegistryKey()
+	found := false
+	for _, candidate := range candidates {
+		key, err := registry.OpenKey(candidate.hive, candidate.keyPath)
+		if err != nil {
+			continue
+		}
+		LogForDebug("Import values from " + candidate.hive + `\` + candidate.keyPath)
+		values.Merge(key.(*MemoryRegistryKey))
+		found = true
+	}
+	if !found {
+		return nil, &HostError{
+			Code:    ERROR_CODE_NOT_FOUND,
+			Message: `no key under ` + REGISTRY_POLICY_KEY_PATH,
+			Path:    path,
+		}
+	}
+	return values, nil
+}
+
+// Reads Common.txt with lines like "CountEnabled=True", and list files like
+// TrustedDomains.txt with an item per line. Files denied by the access policy
+// are skipped.
+func ReadOutlookConfigDir(dir string) (*MemoryRegistryKey, []string, *HostError) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, nil, &HostError{Code: ERROR_CODE_INVALID_PATH, Message: err.Error(), Path: dir}
+	}
+	sort.Strings(files)
+	values := NewMemoryRegistryKey()
+	skipped := []string{}
+	var deniedError *HostError
+	found := false
+	for _, file := range files {
+		if hostError := CheckFileAccess(file, file); hostError != nil {
+			skipped = append(skipped, filepath.Base(file)+": "+hostError.Message)
+			deniedError = hostError
+			continue
+		}
+		buffer, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, NewFileError(file, err)
+		}
+		contents, _, hostError := DecodeContents(buffer, ENCODING_AUTO)
+		if hostError != nil {
+			hostError.Path = file
+			return nil, nil, hostError
+		}
+		found = true
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if strings.EqualFold(filepath.Base(file), OUTLOOK_COMMON_CONFIG_FILE_NAME) {
+			ParseOutlookCommonConfig(contents, values)
+		} else {
+			values.SetValue(name, RegistryValue{REG_TYPE_MULTI_SZ, ParseOutlookListConfig(contents)})
+		}
+	}
+	if !found && deniedError != nil {
+		return nil, nil, deniedError
+	}
+	if !found {
+		return nil, nil, &HostError{Code: ERROR_CODE_NOT_FOUND, Message: "no config file", Path: dir}
+	}
+	return values, skipped, nil
+}
+
+func ParseOutlookCommonConfig(contents string, values *MemoryRegistryKey) {
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		name, data, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		data = strings.TrimSpace(data)
+		switch {
+		case strings.EqualFold(data, "true"):
+			values.SetValue(name, RegistryValue{REG_TYPE_DWORD, uint64(1)})
+		case strings.EqualFold(data, "false"):
+			values.SetValue(name, RegistryValue{REG_TYPE_DWORD, uint64(0)})
+		default:
+			if number, err := strconv.ParseUint(data, 10, 64); err == nil {
+				values.SetValue(name, RegistryValue{REG_TYPE_DWORD, number})
+			} else {
+				values.SetValue(name, RegistryValue{REG_TYPE_SZ, data})
+			}
+		}
+	}
+}
+
+func ParseOutlookListConfig(contents string) []string {
+	items := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		item := NormalizeItem(line)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// Converts values to configs in the format same to exported configs, and
+// returns descriptions of values which cannot be converted.
+func ConvertOutlookConfigs(values *MemoryRegistryKey) (configs map[string]interface{}, unsupported []string) {
+	configs = map[string]interface{}{"configsVersion": TB_CONFIGS_VERSION}
+	unsupported = []string{}
+	userRules := []interface{}{}
+	handled := map[string]bool{}
+
+	for _, mapping := range OutlookConfigMappings {
+		if _, err := values.GetValue(mapping.Name); err != nil {
+			continue
+		}
+		handled[strings.ToLower(mapping.Name)] = true
+		data, err := GetPolicyValue(values, mapping.Name, mapping.Type)
+		if err != nil {
+			unsupported = append(unsupported, fmt.Sprintf("%s: invalid value for %s: %s", mapping.Name, mapping.ConfigKey, err.Error()))
+			continue
+		}
+		configs[mapping.ConfigKey] = data
+	}
+
+	for _, mapping := range OutlookRuleMappings {
+		if _, err := values.GetValue(mapping.Name); err != nil {
+			continue
+		}
+		handled[strings.ToLower(mapping.Name)] = true
+		items, err := values.GetStringsValue(mapping.Name)
+		if err != nil {
+			unsupported = append(unsupported, fmt.Sprintf("%s: invalid value for the rule %s: %s", mapping.Name, mapping.RuleID, err.Error()))
+			continue
+		}
+		userRules = append(userRules, map[string]interface{}{
+			"id":         mapping.RuleID,
+			"enabled":    len(items) > 0,
+			"itemsLocal": items,
+		})
+	}
+	if len(userRules) > 0 {
+		configs["userRules"] = userRules
+	}
+
+	for _, name := range values.ValueNames() {
+		if !handled[strings.ToLower(name)] {
+			unsupported = append(unsupported, name+": no equivalent setting in Thunderbird")
+		}
+	}
+	return configs, unsupported
+}
@@ -0,0 +1,146 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/japanese"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportOutlookConfig_RegFile(t *testing.T) {
+	values, skipped, err := LoadOutlookConfigValues(filepath.Join("testdata", "policies.reg"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Empty(t, skipped)
+	configs, unsupported := ConvertOutlookConfigs(values)
+
+	assert.Equal(t, map[string]interface{}{
+		"configsVersion":                          TB_CONFIGS_VERSION,
+		"countdownAllowSkip":                      false,
+		"showCountdown":                           true,
+		"countdownSeconds":                        uint64(10),
+		"confirmMultipleRecipientDomains":         true,
+		"minConfirmMultipleRecipientDomainsCount": uint64(2),
+		"internalDomains":                         []string{"example.com", "example.org"},
+		"userRules": []interface{}{
+			map[string]interface{}{
+				"id":         "builtInAttentionTerms",
+				"enabled":    true,
+				"itemsLocal": []string{"社外秘"},
+			},
+		},
+	}, configs)
+	assert.Equal(t, []string{
+		"ConfirmationMode: no equivalent setting in Thunderbird",
+		"TopMessage: no equivalent setting in Thunderbird",
+		"UserRules: no equivalent setting in Thunderbird",
+	}, unsupported)
+}
+
+func TestImportOutlookConfig_ConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	WritePolicyFile(t, filepath.Join(dir, "Common.txt"), "CountEnabled = True\r\nCountSeconds = 5\r\nSafeBccEnabled = false\r\nSafeBccThreshold = many\r\nFileWarning = True\r\n")
+	WritePolicyFile(t, filepath.Join(dir, "TrustedDomains.txt"), "example.com\r\n# comment\r\n\r\nexample.org\r\n")
+	WritePolicyFile(t, filepath.Join(dir, "UnsafeDomains.txt"), "")
+	if err := ioutil.WriteFile(filepath.Join(dir, "UnsafeFiles.txt"), EncodeForTest(t, japanese.ShiftJIS, "社外秘\r\n機密\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, skipped, err := LoadOutlookConfigValues(filepath.Join(dir, "Common.txt"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Empty(t, skipped)
+	configs, unsupported := ConvertOutlookConfigs(values)
+
+	assert.Equal(t, map[string]interface{}{
+		"configsVersion":                  TB_CONFIGS_VERSION,
+		"showCountdown":                   true,
+		"countdownSeconds":                uint64(5),
+		"confirmMultipleRecipientDomains": false,
+		"internalDomains":                 []string{"example.com", "example.org"},
+		"userRules": []interface{}{
+			map[string]interface{}{
+				"id":         "builtInAttentionDomains",
+				"enabled":    false,
+				"itemsLocal": []string{},
+			},
+			map[string]interface{}{
+				"id":         "builtInAttentionTerms",
+				"enabled":    true,
+				"itemsLocal": []string{"社外秘", "機密"},
+			},
+		},
+	}, configs)
+	assert.Equal(t, []string{
+		"SafeBccThreshold: invalid value for minConfirmMultipleRecipientDomainsCount: unexpected key value type",
+		"FileWarning: no equivalent setting in Thunderbird",
+	}, unsupported)
+}
+
+func TestImportOutlookConfig_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := LoadOutlookConfigValues(dir)
+	assert.Equal(t, ERROR_CODE_NOT_FOUND, err.Code)
+
+	_, _, err = LoadOutlookConfigValues(filepath.Join("..", "managed-storage-examples", "local-machine.reg"))
+	assert.Equal(t, ERROR_CODE_NOT_FOUND, err.Code)
+}
+
+func TestImportOutlookConfig_ConfigDirDeniedByAccessPolicy(t *testing.T) {
+	dir := t.TempDir()
+	WritePolicyFile(t, filepath.Join(dir, "Common.txt"), "CountEnabled = True\r\n")
+	WritePolicyFile(t, filepath.Join(dir, "TrustedDomains.txt"), "secret-partner.example\r\n")
+	UseAccessPolicy(t, &AccessPolicy{Patterns: []string{filepath.Join(dir, "Common.txt")}})
+
+	values, skipped, err := LoadOutlookConfigValues(filepath.Join(dir, "Common.txt"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"TrustedDomains.txt: access denied by the policy"}, skipped)
+	configs, _ := ConvertOutlookConfigs(values)
+	assert.Equal(t, true, configs["showCountdown"])
+	assert.NotContains(t, configs, "internalDomains")
+
+	UseAccessPolicy(t, &AccessPolicy{Patterns: []string{dir}})
+	_, _, err = LoadOutlookConfigValues(dir)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_ACCESS_DENIED, err.Code)
+		assert.Equal(t, filepath.Join(dir, "TrustedDomains.txt"), err.Path)
+	}
+}
+
+func TestImportOutlookConfig_CLI(t *testing.T) {
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	path, _ := json.Marshal(filepath.Join("testdata", "policies.reg"))
+	context := &Context{
+		Command:       "import-outlook-config",
+		CommandParams: `{"path":` + string(path) + `}`,
+		Output:        &output,
+		ErrorOut:      &errorOut,
+	}
+
+	err := ProcessRequest(context)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"warning: ConfirmationMode: no equivalent setting in Thunderbird\n"+
+			"warning: TopMessage: no equivalent setting in Thunderbird\n"+
+			"warning: UserRules: no equivalent setting in Thunderbird\n",
+		errorOut.String())
+
+	var configs map[string]interface{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &configs))
+	assert.Equal(t, float64(TB_CONFIGS_VERSION), configs["configsVersion"])
+	assert.Equal(t, []interface{}{"example.com", "example.org"}, configs["internalDomains"])
+}
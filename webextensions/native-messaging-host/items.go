@@ -0,0 +1,274 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	LIST_FORMAT_AUTO  = "auto"
+	LIST_FORMAT_LINES = "lines"
+	LIST_FORMAT_CSV   = "csv"
+	LIST_FORMAT_JSON  = "json"
+)
+
+type ParseWarning struct {
+	Line    int    `json:"line"` // 1-origin, 0 if unknown
+	Message string `json:"message"`
+}
+
+type FetchItemsResponse struct {
+	ResponseMeta
+	Items    []string       `json:"items"`
+	Warnings []ParseWarning `json:"warnings"`
+	Format   string         `json:"format,omitempty"`
+	Cached   bool           `json:"cached,omitempty"`
+	Encoding string         `json:"encoding,omitempty"`
+	Error    string         `json:"error"`
+}
+
+func (response *FetchItemsResponse) PrintForCLI(output io.Writer) error {
+	if response.Error != "" {
+		return fmt.Errorf("failed to fetch items: " + response.Error)
+	}
+	for _, item := range response.Items {
+		fmt.Fprintln(output, item)
+	}
+	for _, warning := range response.Warnings {
+		fmt.Fprintf(output, "# warning at line %d: %s\n", warning.Line, warning.Message)
+	}
+	return nil
+}
+
+func init() {
+	params := append([]CommandParam{}, FetchParams...)
+	params = append(params,
+		CommandParam{"format", "string", false, `"auto" (default), "lines", "csv" or "json"`},
+		CommandParam{"section", "string", false, "read only items in the [section] of a list file"},
+	)
+	RegisterCommand(&Command{
+		Name:    "fetch-items",
+		Params:  params,
+		Help:    "read a list file and return its items",
+		Example: `{"path":"c:\\path\\to\\file","format":"auto"}`,
+		Handler: HandleFetchItems,
+	})
+}
+
+func HandleFetchItems(request *Request) (Response, error) {
+	response := &FetchItemsResponse{Items: []string{}, Warnings: []ParseWarning{}}
+	contents, encoding, cached, err := FetchContents(request.Params)
+	if err != nil {
+		response.Error = err.Error()
+		response.ErrorDetail = err
+		return response, nil
+	}
+	response.Encoding = encoding
+	response.Cached = cached
+
+	format, err := DetectListFormat(request.Params.Path, contents, request.Params.Format)
+	if err != nil {
+		response.Error = err.Error()
+		response.ErrorDetail = err
+		return response, nil
+	}
+	response.Format = format
+	response.Items, response.Warnings = ParseListItems(contents, format, request.Params.Section)
+	LogForDebug(fmt.Sprintf("Parsed %d items with %d warnings from %s", len(response.Items), len(response.Warnings), request.Params.Path))
+	return response, nil
+}
+
+func DetectListFormat(path string, contents string, requestedFormat string) (string, *HostError) {
+	switch strings.ToLower(requestedFormat) {
+	case "", LIST_FORMAT_AUTO:
+	case LIST_FORMAT_LINES:
+		return LIST_FORMAT_LINES, nil
+	case LIST_FORMAT_CSV:
+		return LIST_FORMAT_CSV, nil
+	case LIST_FORMAT_JSON:
+		return LIST_FORMAT_JSON, nil
+	default:
+		return "", &HostError{
+			Code:    ERROR_CODE_INVALID_PARAMS,
+			Message: "unknown format: " + requestedFormat,
+			Param:   "format",
+		}
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(contents), "[") {
+		var array []interface{}
+		if json.Unmarshal([]byte(contents), &array) == nil {
+			return LIST_FORMAT_JSON, nil
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return LIST_FORMAT_CSV, nil
+	}
+	return LIST_FORMAT_LINES, nil
+}
+
+type ItemsCollector struct {
+	Items    []string
+	Warnings []ParseWarning
+	known    map[string]int
+}
+
+func NewItemsCollector() *ItemsCollector {
+	return &ItemsCollector{
+		Items:    []string{},
+		Warnings: []ParseWarning{},
+		known:    map[string]int{},
+	}
+}
+
+var invisibleCharactersMatcher = regexp.MustCompile("[\u200b\u200c\u200d\u2060\ufeff]")
+
+func NormalizeItem(item string) string {
+	item = invisibleCharactersMatcher.ReplaceAllString(item, "")
+	return norm.NFC.String(strings.TrimSpace(item))
+}
+
+func (collector *ItemsCollector) Add(item string, line int) {
+	item = NormalizeItem(item)
+	if item == "" {
+		return
+	}
+	if firstLine, known := collector.known[item]; known {
+		collector.Warn(line, fmt.Sprintf("duplicated item %q (first appeared at line %d)", item, firstLine))
+		return
+	}
+	collector.known[item] = line
+	collector.Items = append(collector.Items, item)
+}
+
+func (collector *ItemsCollector) Warn(line int, message string) {
+	collector.Warnings = append(collector.Warnings, ParseWarning{line, message})
+}
+
+func ParseListItems(contents string, format string, section string) (items []string, warnings []ParseWarning) {
+	collector := NewItemsCollector()
+	switch format {
+	case LIST_FORMAT_CSV:
+		ParseCSVItems(contents, collector)
+	case LIST_FORMAT_JSON:
+		ParseJSONItems(contents, collector)
+	default:
+		ParseLineItems(contents, section, collector)
+	}
+	if section != "" && format != LIST_FORMAT_LINES {
+		collector.Warn(0, "section is ignored for the format "+format)
+	}
+	return collector.Items, collector.Warnings
+}
+
+var sectionHeaderMatcher = regexp.MustCompile(`^\[([^\]]*)\]$`)
+
+// Parses a list separated with whitespaces, commas or pipes, like the add-on
+// does. Quoted items may contain separators, and "" in a quoted item means
+// a quotation mark. Texts after "#" are comments, and lines like "[name]"
+// are section headers.
+func ParseLineItems(contents string, section string, collector *ItemsCollector) {
+	currentSection := ""
+	for index, line := range strings.Split(contents, "\n") {
+		lineNumber := index + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if matched := sectionHeaderMatcher.FindStringSubmatch(line); matched != nil {
+			currentSection = strings.TrimSpace(matched[1])
+			continue
+		}
+		if section != "" && currentSection != section {
+			continue
+		}
+
+		var item strings.Builder
+		inQuote := false
+		runes := []rune(line)
+		for position := 0; position < len(runes); position++ {
+			char := runes[position]
+			switch {
+			case inQuote && char == '"':
+				if position+1 < len(runes) && runes[position+1] == '"' {
+					item.WriteRune('"')
+					position++
+				} else {
+					inQuote = false
+				}
+			case inQuote:
+				item.WriteRune(char)
+			case char == '"':
+				inQuote = true
+			case char == '#' && item.Len() == 0:
+				position = len(runes)
+			case char == ',' || char == '|' || char == ' ' || char == '\t' || char == '\u3000':
+				collector.Add(item.String(), lineNumber)
+				item.Reset()
+			default:
+				item.WriteRune(char)
+			}
+		}
+		if inQuote {
+			collector.Warn(lineNumber, "unterminated quotation")
+		}
+		collector.Add(item.String(), lineNumber)
+	}
+}
+
+func ParseCSVItems(contents string, collector *ItemsCollector) {
+	reader := csv.NewReader(strings.NewReader(contents))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) {
+				line = parseError.Line
+			}
+			collector.Warn(line, err.Error())
+			if record == nil {
+				continue
+			}
+		}
+		for _, field := range record {
+			collector.Add(field, line)
+		}
+	}
+}
+
+func ParseJSONItems(contents string, collector *ItemsCollector) {
+	var array []interface{}
+	if err := json.Unmarshal([]byte(contents), &array); err != nil {
+		collector.Warn(0, "invalid JSON array: "+err.Error())
+		return
+	}
+	for index, value := range array {
+		item, isString := value.(string)
+		if !isString {
+			collector.Warn(0, fmt.Sprintf("item at index %d is not a string: %v", index, value))
+			continue
+		}
+		collector.Add(item, 0)
+	}
+}
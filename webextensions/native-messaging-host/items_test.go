@@ -0,0 +1,94 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseListItems_Lines(t *testing.T) {
+	contents := "# attention domains\n" +
+		"\n" +
+		"example.com, example.net | example.org\n" +
+		"  example.jp  # comment\n" +
+		"\"社外 秘\" \"say \"\"hello\"\"\"\n" +
+		"example.com\n" +
+		"\ufeffzero\u200bwidth\n" +
+		"\"unterminated\n"
+	items, warnings := ParseListItems(contents, LIST_FORMAT_LINES, "")
+	assert.Equal(t, []string{
+		"example.com",
+		"example.net",
+		"example.org",
+		"example.jp",
+		"社外 秘",
+		`say "hello"`,
+		"zerowidth",
+		"unterminated",
+	}, items)
+	assert.Equal(t, []ParseWarning{
+		{6, `duplicated item "example.com" (first appeared at line 3)`},
+		{8, "unterminated quotation"},
+	}, warnings)
+}
+
+func TestParseListItems_Sections(t *testing.T) {
+	contents := "common\n" +
+		"[partner-a]\n" +
+		"a.example.com\n" +
+		"[partner-b]\n" +
+		"b.example.com\n"
+
+	items, _ := ParseListItems(contents, LIST_FORMAT_LINES, "")
+	assert.Equal(t, []string{"common", "a.example.com", "b.example.com"}, items)
+
+	items, _ = ParseListItems(contents, LIST_FORMAT_LINES, "partner-b")
+	assert.Equal(t, []string{"b.example.com"}, items)
+}
+
+func TestParseListItems_CSV(t *testing.T) {
+	contents := "# exported from Excel\n" +
+		"example.com,\"foo, bar\"\n" +
+		"example.net,example.com\n"
+	items, warnings := ParseListItems(contents, LIST_FORMAT_CSV, "")
+	assert.Equal(t, []string{"example.com", "foo, bar", "example.net"}, items)
+	assert.Equal(t, []ParseWarning{
+		{3, `duplicated item "example.com" (first appeared at line 2)`},
+	}, warnings)
+}
+
+func TestParseListItems_JSON(t *testing.T) {
+	items, warnings := ParseListItems(`["example.com", " example.net ", 1, "example.com"]`, LIST_FORMAT_JSON, "")
+	assert.Equal(t, []string{"example.com", "example.net"}, items)
+	assert.Len(t, warnings, 2)
+}
+
+func TestDetectListFormat(t *testing.T) {
+	cases := []struct {
+		path      string
+		contents  string
+		requested string
+		expected  string
+	}{
+		{"list.txt", "example.com", "", LIST_FORMAT_LINES},
+		{"list.txt", `["example.com"]`, "", LIST_FORMAT_JSON},
+		{"list.txt", "[section]\nexample.com", LIST_FORMAT_AUTO, LIST_FORMAT_LINES},
+		{"list.CSV", "example.com", "", LIST_FORMAT_CSV},
+		{"list.csv", "example.com", LIST_FORMAT_LINES, LIST_FORMAT_LINES},
+	}
+	for _, c := range cases {
+		format, err := DetectListFormat(c.path, c.contents, c.requested)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, format)
+	}
+
+	_, err := DetectListFormat("list.txt", "", "xml")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ERROR_CODE_INVALID_PARAMS, err.Code)
+	}
+}
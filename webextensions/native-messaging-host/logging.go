@@ -0,0 +1,207 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const LOG_FILE_NAME_PATTERN = "com.clear_code.flexible_confirm_mail_we_host.log.%Y%m%d%H%M.txt"
+
+const (
+	LOG_LEVEL_ERROR = "error"
+	LOG_LEVEL_WARN  = "warn"
+	LOG_LEVEL_INFO  = "info"
+	LOG_LEVEL_DEBUG = "debug"
+	LOG_LEVEL_TRACE = "trace"
+)
+
+// Less verbose levels have smaller numbers.
+var LogLevelOrders = map[string]int{
+	LOG_LEVEL_ERROR: 0,
+	LOG_LEVEL_WARN:  1,
+	LOG_LEVEL_INFO:  2,
+	LOG_LEVEL_DEBUG: 3,
+	LOG_LEVEL_TRACE: 4,
+}
+
+const (
+	LOG_FORMAT_JSON = "json" // JSON lines, for log collectors
+	LOG_FORMAT_TEXT = "text"
+)
+
+// Entries of all levels for the request being handled, to be returned with
+// "returnLogs". Older entries are dropped over the cap.
+var DebugLogs []LogEntry
+var DroppedDebugLogsCount int
+
+const MAX_DEBUG_LOGS = 1000
+
+var Logging bool
+var LogLevel = LOG_LEVEL_INFO
+var LogFormat = LOG_FORMAT_JSON
+
+// Fields to correlate entries with the request being handled.
+type LogContext struct {
+	Command   string
+	CallerID  string
+	RequestID json.RawMessage
+}
+
+var CurrentLogContext LogContext
+
+type LogEntry struct {
+	Time      time.Time       `json:"time"`
+	Level     string          `json:"level"`
+	Message   string          `json:"message"`
+	Version   string          `json:"version"`
+	PID       int             `json:"pid"`
+	Command   string          `json:"command,omitempty"`
+	CallerID  string          `json:"callerId,omitempty"`
+	RequestID json.RawMessage `json:"requestId,omitempty"`
+}
+
+func LogForError(message string) {
+	LogAtLevel(LOG_LEVEL_ERROR, message)
+}
+
+func LogForWarn(message string) {
+	LogAtLevel(LOG_LEVEL_WARN, message)
+}
+
+func LogForInfo(message string) {
+	LogAtLevel(LOG_LEVEL_INFO, message)
+}
+
+func LogForDebug(message string) {
+	LogAtLevel(LOG_LEVEL_DEBUG, message)
+}
+
+func LogForTrace(message string) {
+	LogAtLevel(LOG_LEVEL_TRACE, message)
+}
+
+func IsLogLevelEnabled(level string) bool {
+	return LogLevelOrders[level] <= LogLevelOrders[LogLevel]
+}
+
+func LogAtLevel(level string, message string) {
+	message = RedactLogMessage(message)
+	entry := NewLogEntry(level, message)
+	CollectDebugLog(entry)
+	if !Logging || !IsLogLevelEnabled(level) {
+		return
+	}
+	if !RunInCLI {
+		fmt.Fprintln(ErrorOut, "["+level+"] "+message)
+	}
+	if LogFormat == LOG_FORMAT_TEXT {
+		log.Print("[" + level + "] " + message + "\r\n")
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	log.Writer().Write(append(line, '\n'))
+}
+
+func NewLogEntry(level string, message string) *LogEntry {
+	return &LogEntry{
+		Time:      time.Now(),
+		Level:     level,
+		Message:   message,
+		Version:   VERSION,
+		PID:       os.Getpid(),
+		Command:   CurrentLogContext.Command,
+		CallerID:  CurrentLogContext.CallerID,
+		RequestID: CurrentLogContext.RequestID,
+	}
+}
+
+func CollectDebugLog(entry *LogEntry) {
+	DebugLogs = append(DebugLogs, *entry)
+	if len(DebugLogs) > MAX_DEBUG_LOGS {
+		DroppedDebugLogsCount += len(DebugLogs) - MAX_DEBUG_LOGS
+		DebugLogs = DebugLogs[len(DebugLogs)-MAX_DEBUG_LOGS:]
+	}
+}
+
+func ResetDebugLogs() {
+	DebugLogs = nil
+	DroppedDebugLogsCount = 0
+}
+
+// The "debug" flag of old versions means the debug level.
+func GetRequestLogLevel(request *Request) string {
+	if _, known := LogLevelOrders[request.LogLevel]; known {
+		return request.LogLevel
+	}
+	if request.Debug {
+		return LOG_LEVEL_DEBUG
+	}
+	return LOG_LEVEL_INFO
+}
+
+func GetRequestLogFormat(request *Request) string {
+	if request.LogFormat == LOG_FORMAT_TEXT {
+		return LOG_FORMAT_TEXT
+	}
+	return LOG_FORMAT_JSON
+}
+
+// Candidates of the log directory, the directory given by the request first
+// and the temporary directory last.
+func GetLogDirectoryCandidates(request *Request) []string {
+	candidates := []string{}
+	if request.LogDirectory != "" {
+		candidates = append(candidates, ExpandAllEnvVars(request.LogDirectory))
+	}
+	candidates = append(candidates, GetDefaultLogDirectories()...)
+	return append(candidates, os.TempDir())
+}
+
+// Returns the first writable directory, creating it if needed, and problems
+// of skipped candidates.
+func ResolveLogDirectory(candidates []string) (dir string, problems []string, err error) {
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		// Relative paths, including ones with unexpanded variables like
+		// "%LOCALAPPDATA%", would be created under the working directory.
+		if !filepath.IsAbs(candidate) {
+			problems = append(problems, "log directory "+candidate+" is not an absolute path")
+			continue
+		}
+		if err := EnsureWritableDirectory(candidate); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		return candidate, problems, nil
+	}
+	return "", problems, fmt.Errorf("no writable log directory: %s", strings.Join(problems, "; "))
+}
+
+func EnsureWritableDirectory(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("cannot create log directory %s: %w", dir, err)
+	}
+	file, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("log directory %s is not writable: %w", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
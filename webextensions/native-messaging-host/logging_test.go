@@ -0,0 +1,122 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetLogDirectoryCandidates(t *testing.T) {
+	t.Setenv("TEST_LOG_DIR", "/tmp/logs")
+	candidates := GetLogDirectoryCandidates(&Request{LogDirectory: "${TEST_LOG_DIR}/host"})
+	assert.Equal(t, "/tmp/logs/host", candidates[0])
+	assert.Equal(t, os.TempDir(), candidates[len(candidates)-1])
+
+	t.Setenv("TEST_LOG_DIR_PERCENT", "/tmp/percent")
+	candidates = GetLogDirectoryCandidates(&Request{LogDirectory: "%TEST_LOG_DIR_PERCENT%/host"})
+	assert.Equal(t, "/tmp/percent/host", candidates[0])
+
+	candidates = GetLogDirectoryCandidates(&Request{})
+	assert.Equal(t, append(GetDefaultLogDirectories(), os.TempDir()), candidates)
+}
+
+func TestResolveLogDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	notDir := filepath.Join(tmpDir, "file")
+	assert.NoError(t, os.WriteFile(notDir, []byte{}, 0600))
+	logDir := filepath.Join(tmpDir, "logs", "host")
+
+	dir, problems, err := ResolveLogDirectory([]string{"", filepath.Join(notDir, "logs"), logDir})
+	assert.NoError(t, err)
+	assert.Equal(t, logDir, dir)
+	assert.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "cannot create log directory "+filepath.Join(notDir, "logs"))
+	assert.DirExists(t, logDir)
+	entries, _ := os.ReadDir(logDir)
+	assert.Empty(t, entries)
+
+	dir, problems, err = ResolveLogDirectory([]string{`%UNDEFINED_LOG_DIR%\logs`, filepath.Join("relative", "logs"), logDir})
+	assert.NoError(t, err)
+	assert.Equal(t, logDir, dir)
+	assert.Equal(t, []string{
+		`log directory %UNDEFINED_LOG_DIR%\logs is not an absolute path`,
+		"log directory " + filepath.Join("relative", "logs") + " is not an absolute path",
+	}, problems)
+	assert.NoDirExists(t, "relative")
+
+	_, problems, err = ResolveLogDirectory([]string{filepath.Join(notDir, "logs")})
+	assert.Len(t, problems, 1)
+	assert.ErrorContains(t, err, "no writable log directory: cannot create log directory")
+}
+
+func UseTestLogger(t *testing.T, level string, format string) *bytes.Buffer {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	Logging, LogLevel, LogFormat, RunInCLI = true, level, format, true
+	log.SetOutput(buffer)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		Logging, LogLevel, LogFormat, RunInCLI = false, LOG_LEVEL_INFO, LOG_FORMAT_JSON, false
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+		CurrentLogContext = LogContext{}
+	})
+	return buffer
+}
+
+func TestLogAtLevel_JSON(t *testing.T) {
+	buffer := UseTestLogger(t, LOG_LEVEL_INFO, LOG_FORMAT_JSON)
+	CurrentLogContext = LogContext{Command: "fetch", CallerID: "addon@example.com", RequestID: json.RawMessage(`"req-1"`)}
+
+	LogForWarn("Access denied")
+	LogForDebug("not logged")
+
+	lines := bytes.Split(bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), []byte("\n"))
+	assert.Len(t, lines, 1)
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(lines[0], &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "Access denied", entry["message"])
+	assert.Equal(t, VERSION, entry["version"])
+	assert.Equal(t, float64(os.Getpid()), entry["pid"])
+	assert.Equal(t, "fetch", entry["command"])
+	assert.Equal(t, "addon@example.com", entry["callerId"])
+	assert.Equal(t, "req-1", entry["requestId"])
+	assert.NotEmpty(t, entry["time"])
+}
+
+func TestLogAtLevel_Text(t *testing.T) {
+	buffer := UseTestLogger(t, LOG_LEVEL_TRACE, LOG_FORMAT_TEXT)
+	LogForTrace("Received request")
+	assert.Equal(t, "[trace] Received request\r\n", buffer.String())
+}
+
+func TestGetRequestLogLevel(t *testing.T) {
+	assert.Equal(t, LOG_LEVEL_INFO, GetRequestLogLevel(&Request{}))
+	assert.Equal(t, LOG_LEVEL_DEBUG, GetRequestLogLevel(&Request{Debug: true}))
+	assert.Equal(t, LOG_LEVEL_TRACE, GetRequestLogLevel(&Request{Debug: true, LogLevel: "trace"}))
+	assert.Equal(t, LOG_LEVEL_INFO, GetRequestLogLevel(&Request{LogLevel: "verbose"}))
+}
+
+func TestCollectDebugLog(t *testing.T) {
+	t.Cleanup(ResetDebugLogs)
+	ResetDebugLogs()
+	for i := 0; i < MAX_DEBUG_LOGS+5; i++ {
+		LogForTrace(fmt.Sprint(i))
+	}
+	assert.Len(t, DebugLogs, MAX_DEBUG_LOGS)
+	assert.Equal(t, 5, DroppedDebugLogsCount)
+	assert.Equal(t, "5", DebugLogs[0].Message)
+	assert.Equal(t, LOG_LEVEL_TRACE, DebugLogs[0].Level)
+}
@@ -0,0 +1,240 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Layers of configs, in the order of precedence from the lowest. Locked
+// managed configs are applied over user's ones.
+const (
+	CONFIG_LAYER_DEFAULT        = "default"       // defaults of the add-on
+	CONFIG_LAYER_MANAGED        = "managed"       // managed storage, locked unless "key:locked" is false
+	CONFIG_LAYER_POLICY_DEFAULT = "policyDefault" // Default of policies
+	CONFIG_LAYER_USER           = "user"          // configured by the user
+	CONFIG_LAYER_POLICY_LOCKED  = "policyLocked"  // Locked of policies
+)
+
+const MANAGED_CONFIG_LOCKED_SUFFIX = ":locked"
+
+// Policies like "BuiltInAttentionDomainsItems" are applied to items of the
+// rule "builtInAttentionDomains".
+var RuleItemsPolicyKeyMatcher = regexp.MustCompile(`^(BuiltIn.+)Items$`)
+
+// Overridable for testing.
+var OpenMergedConfigPolicySources = OpenPolicySources
+
+const MERGED_CONFIG_MAX_VALUE_LENGTH_FOR_CLI = 60
+
+type MergedConfigEntry struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Layer  string      `json:"layer"`
+	Source string      `json:"source,omitempty"` // for policy layers
+	Locked bool        `json:"locked"`
+}
+
+type MergedConfigResponse struct {
+	ResponseMeta
+	Configs  []MergedConfigEntry `json:"configs"`
+	Problems []string            `json:"problems"`
+	Error    string              `json:"error"`
+}
+
+func (response *MergedConfigResponse) WarningsForCLI() []string {
+	return response.Problems
+}
+
+func (response *MergedConfigResponse) PrintForCLI(output io.Writer) error {
+	if response.Error != "" {
+		return fmt.Errorf("failed to merge configs: " + response.Error)
+	}
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "KEY\tVALUE\tLAYER\tSOURCE\tLOCKED")
+	for _, entry := range response.Configs {
+		value := FormatPolicyValueForCLI(entry.Value)
+		if runes := []rune(value); len(runes) > MERGED_CONFIG_MAX_VALUE_LENGTH_FOR_CLI {
+			value = string(runes[:MERGED_CONFIG_MAX_VALUE_LENGTH_FOR_CLI]) + "..."
+		}
+		locked := ""
+		if entry.Locked {
+			locked = "yes"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", entry.Key, value, entry.Layer, entry.Source, locked)
+	}
+	return writer.Flush()
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name: "merged-config",
+		Params: []CommandParam{
+			{"defaults", "object", false, "default configs of the add-on"},
+			{"managed", "object", false, "configs from the managed storage"},
+			{"user", "object", false, "configs changed by the user"},
+			{"path", "string", false, "path to configs exported from the options page, used as user configs"},
+		},
+		Help:    "show the effective value of each config, with the layer it comes from",
+		Example: `{"path":"flexconfirmmail.json"}`,
+		Handler: HandleMergedConfig,
+	})
+}
+
+func HandleMergedConfig(request *Request) (Response, error) {
+	response := &MergedConfigResponse{Configs: []MergedConfigEntry{}, Problems: []string{}}
+	user := request.Params.User
+	if request.Params.Path != "" {
+		var err *HostError
+		user, err = ReadExportedConfigs(request.Params.Path)
+		if err != nil {
+			response.Error = err.Error()
+			response.ErrorDetail = err
+			return response, nil
+		}
+	}
+
+	sources := OpenMergedConfigPolicySources()
+	defer sources.Close()
+	response.Problems = append(response.Problems, sources.Problems...)
+	response.Configs = MergeConfigs(request.Params.Defaults, sources.Apply(), user, request.Params.Managed)
+	return response, nil
+}
+
+func ReadExportedConfigs(path string) (map[string]interface{}, *HostError) {
+	expanded := ExpandAllEnvVars(path)
+	if hostError := CheckFileAccess(path, expanded); hostError != nil {
+		return nil, hostError
+	}
+	buffer, err := ioutil.ReadFile(expanded)
+	if err != nil {
+		return nil, NewFileError(path, err)
+	}
+	configs := map[string]interface{}{}
+	if err := json.Unmarshal(buffer, &configs); err != nil {
+		return nil, &HostError{Code: ERROR_CODE_INVALID_PATH, Message: "invalid configs: " + err.Error(), Path: path}
+	}
+	return configs, nil
+}
+
+// Merges configs like the add-on does: unlocked managed configs are used as
+// defaults, policies are applied to defaults and locked configs after
+// configs are loaded from storages, and policies of rule items are applied
+// to rules.
+func MergeConfigs(defaults map[string]interface{}, policies OutlookGPOConfigsResponse, user map[string]interface{}, managed map[string]interface{}) []MergedConfigEntry {
+	merged := map[string]MergedConfigEntry{}
+	apply := func(configs map[string]interface{}, layer string, locked bool) {
+		for key, value := range configs {
+			merged[key] = MergedConfigEntry{Key: key, Value: value, Layer: layer, Locked: locked}
+		}
+	}
+	applyPolicy := func(configs TbStyleConfigs, sources map[string]string, layer string, locked bool, ruleItems bool) {
+		remoteKeys := []string{}
+		for remoteKey := range configs {
+			remoteKeys = append(remoteKeys, remoteKey)
+		}
+		sort.Strings(remoteKeys)
+		for _, remoteKey := range remoteKeys {
+			value := configs[remoteKey]
+			matched := RuleItemsPolicyKeyMatcher.FindStringSubmatch(remoteKey)
+			if (matched != nil) != ruleItems {
+				continue
+			}
+			if matched != nil {
+				id := strings.ToLower(matched[1][:1]) + matched[1][1:]
+				ApplyRuleItemsToMergedConfigs(merged, id, value, layer, sources[remoteKey], locked)
+				continue
+			}
+			key := strings.ToLower(remoteKey[:1]) + remoteKey[1:]
+			merged[key] = MergedConfigEntry{Key: key, Value: value, Layer: layer, Source: sources[remoteKey], Locked: locked}
+		}
+	}
+	lockedManaged, unlockedManaged := SplitManagedConfigs(managed)
+
+	apply(defaults, CONFIG_LAYER_DEFAULT, false)
+	apply(unlockedManaged, CONFIG_LAYER_MANAGED, false)
+	applyPolicy(policies.Default, policies.DefaultSources, CONFIG_LAYER_POLICY_DEFAULT, false, false)
+	apply(user, CONFIG_LAYER_USER, false)
+	// Rules are updated with the effective configs including user's ones.
+	applyPolicy(policies.Default, policies.DefaultSources, CONFIG_LAYER_POLICY_DEFAULT, false, true)
+	apply(lockedManaged, CONFIG_LAYER_MANAGED, true)
+	applyPolicy(policies.Locked, policies.LockedSources, CONFIG_LAYER_POLICY_LOCKED, true, false)
+	applyPolicy(policies.Locked, policies.LockedSources, CONFIG_LAYER_POLICY_LOCKED, true, true)
+
+	keys := []string{}
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := []MergedConfigEntry{}
+	for _, key := range keys {
+		entries = append(entries, merged[key])
+	}
+	return entries
+}
+
+// Managed configs are locked unless their "key:locked" flags are false.
+// Keys like "// comment" are comments in examples of managed storages.
+func SplitManagedConfigs(managed map[string]interface{}) (locked map[string]interface{}, unlocked map[string]interface{}) {
+	locked = map[string]interface{}{}
+	unlocked = map[string]interface{}{}
+	for key, value := range managed {
+		if strings.HasSuffix(key, MANAGED_CONFIG_LOCKED_SUFFIX) || strings.HasPrefix(key, "//") {
+			continue
+		}
+		if flag, isBool := managed[key+MANAGED_CONFIG_LOCKED_SUFFIX].(bool); isBool && !flag {
+			unlocked[key] = value
+		} else {
+			locked[key] = value
+		}
+	}
+	return locked, unlocked
+}
+
+// Same to applyOutlookGPOConfigRuleItems() in common.js: Default items are
+// applied to the rule in overrideBaseRules or baseRules, and Locked items
+// to the rule in overrideRules. A new rule is added if there is none.
+func ApplyRuleItemsToMergedConfigs(merged map[string]MergedConfigEntry, id string, items interface{}, layer string, source string, locked bool) {
+	keys := []string{"overrideBaseRules", "baseRules"}
+	if locked {
+		keys = []string{"overrideRules"}
+	}
+	for _, key := range keys {
+		rules, _ := merged[key].Value.([]interface{})
+		for index, rule := range rules {
+			if fields, isObject := rule.(map[string]interface{}); isObject && fields["id"] == id {
+				updatedRules := append([]interface{}{}, rules...)
+				updatedRules[index] = NewRuleWithItems(fields, items)
+				merged[key] = MergedConfigEntry{Key: key, Value: updatedRules, Layer: layer, Source: source, Locked: locked || merged[key].Locked}
+				return
+			}
+		}
+	}
+	rules, _ := merged[keys[0]].Value.([]interface{})
+	updatedRules := append(append([]interface{}{}, rules...), NewRuleWithItems(map[string]interface{}{"id": id}, items))
+	merged[keys[0]] = MergedConfigEntry{Key: keys[0], Value: updatedRules, Layer: layer, Source: source, Locked: locked || merged[keys[0]].Locked}
+}
+
+func NewRuleWithItems(rule map[string]interface{}, items interface{}) map[string]interface{} {
+	updated := map[string]interface{}{}
+	for key, value := range rule {
+		updated[key] = value
+	}
+	if items == nil {
+		items = []string{}
+	}
+	updated["itemsLocal"] = items
+	updated["enabled"] = true
+	return updated
+}
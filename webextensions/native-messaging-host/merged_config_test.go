@@ -0,0 +1,133 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeConfigs(t *testing.T) {
+	policies := OutlookGPOConfigsResponse{
+		Default:        TbStyleConfigs{"CountdownSeconds": uint64(10), "TopMessage": "from policy"},
+		DefaultSources: map[string]string{"CountdownSeconds": "HKLM", "TopMessage": "HKCU"},
+		Locked:         TbStyleConfigs{"ShowCountdown": true},
+		LockedSources:  map[string]string{"ShowCountdown": "HKLM"},
+	}
+	entries := MergeConfigs(
+		map[string]interface{}{"countdownSeconds": 5, "showCountdown": false, "topMessage": "", "debug": false},
+		policies,
+		map[string]interface{}{"topMessage": "from user", "showCountdown": false},
+		map[string]interface{}{"debug": true},
+	)
+
+	assert.Equal(t, []MergedConfigEntry{
+		{Key: "countdownSeconds", Value: uint64(10), Layer: CONFIG_LAYER_POLICY_DEFAULT, Source: "HKLM"},
+		{Key: "debug", Value: true, Layer: CONFIG_LAYER_MANAGED, Locked: true},
+		{Key: "showCountdown", Value: true, Layer: CONFIG_LAYER_POLICY_LOCKED, Source: "HKLM", Locked: true},
+		{Key: "topMessage", Value: "from user", Layer: CONFIG_LAYER_USER},
+	}, entries)
+}
+
+func TestMergeConfigs_ManagedLockedFlags(t *testing.T) {
+	entries := MergeConfigs(
+		map[string]interface{}{"confirmationMode": 0, "debug": false},
+		OutlookGPOConfigsResponse{},
+		map[string]interface{}{"confirmationMode": 2},
+		map[string]interface{}{
+			"// 0 = no confirm":       0,
+			"confirmationMode":        1,
+			"confirmationMode:locked": false,
+			"debug":                   true,
+			"debug:locked":            true,
+			"internalDomains":         []interface{}{"example.com"},
+		},
+	)
+
+	assert.Equal(t, []MergedConfigEntry{
+		{Key: "confirmationMode", Value: 2, Layer: CONFIG_LAYER_USER},
+		{Key: "debug", Value: true, Layer: CONFIG_LAYER_MANAGED, Locked: true},
+		{Key: "internalDomains", Value: []interface{}{"example.com"}, Layer: CONFIG_LAYER_MANAGED, Locked: true},
+	}, entries)
+}
+
+func TestMergeConfigs_RuleItems(t *testing.T) {
+	policies := OutlookGPOConfigsResponse{
+		Default: TbStyleConfigs{
+			"BuiltInAttentionDomainsItems": []string{"example.org"},
+			"BuiltInBlockedDomainsItems":   []string{"blocked.example.com"},
+		},
+		DefaultSources: map[string]string{"BuiltInAttentionDomainsItems": "HKLM", "BuiltInBlockedDomainsItems": "HKLM"},
+		Locked:         TbStyleConfigs{"BuiltInAttentionTermsItems": []string{"secret"}},
+		LockedSources:  map[string]string{"BuiltInAttentionTermsItems": "HKCU"},
+	}
+	entries := MergeConfigs(
+		map[string]interface{}{
+			"baseRules":         []interface{}{map[string]interface{}{"id": "builtInAttentionDomains", "enabled": false}},
+			"overrideBaseRules": []interface{}{},
+			"overrideRules":     []interface{}{},
+		},
+		policies, nil, nil,
+	)
+
+	assert.Equal(t, []MergedConfigEntry{
+		{Key: "baseRules", Value: []interface{}{
+			map[string]interface{}{"id": "builtInAttentionDomains", "enabled": true, "itemsLocal": []string{"example.org"}},
+		}, Layer: CONFIG_LAYER_POLICY_DEFAULT, Source: "HKLM"},
+		{Key: "overrideBaseRules", Value: []interface{}{
+			map[string]interface{}{"id": "builtInBlockedDomains", "enabled": true, "itemsLocal": []string{"blocked.example.com"}},
+		}, Layer: CONFIG_LAYER_POLICY_DEFAULT, Source: "HKLM"},
+		{Key: "overrideRules", Value: []interface{}{
+			map[string]interface{}{"id": "builtInAttentionTerms", "enabled": true, "itemsLocal": []string{"secret"}},
+		}, Layer: CONFIG_LAYER_POLICY_LOCKED, Source: "HKCU", Locked: true},
+	}, entries)
+}
+
+func TestMergedConfig_CLI(t *testing.T) {
+	OpenMergedConfigPolicySources = func() *PolicySources {
+		return &PolicySources{User: &PolicySource{Name: "policies.json", Locked: JSONPolicyValues{"CountdownSeconds": json.RawMessage(`10`)}}}
+	}
+	t.Cleanup(func() {
+		OpenMergedConfigPolicySources = OpenPolicySources
+	})
+
+	dir := t.TempDir()
+	configsFile := filepath.Join(dir, "flexconfirmmail.json")
+	WritePolicyFile(t, configsFile, `{"countdownSeconds":3,"topMessage":"Please check recipients carefully before sending this message"}`)
+	path, _ := json.Marshal(configsFile)
+
+	var output bytes.Buffer
+	var errorOut bytes.Buffer
+	context := &Context{
+		Command:       "merged-config",
+		CommandParams: `{"path":` + string(path) + `,"defaults":{"showCountdown":true}}`,
+		Output:        &output,
+		ErrorOut:      &errorOut,
+	}
+	assert.NoError(t, ProcessRequest(context))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, []string{"KEY", "VALUE", "LAYER", "SOURCE", "LOCKED"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"countdownSeconds", "10", "policyLocked", "policies.json", "yes"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"showCountdown", "true", "default"}, strings.Fields(lines[2]))
+	assert.Contains(t, lines[3], `"Please check recipients carefully before sending this messa...`)
+}
+
+func TestMergedConfig_InvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	configsFile := filepath.Join(dir, "flexconfirmmail.json")
+	WritePolicyFile(t, configsFile, `[]`)
+
+	response, err := HandleMergedConfig(&Request{Params: RequestParams{Path: configsFile}})
+	assert.NoError(t, err)
+	assert.Equal(t, ERROR_CODE_INVALID_PATH, response.Meta().ErrorDetail.Code)
+}
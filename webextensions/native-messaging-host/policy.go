@@ -0,0 +1,289 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Source of policy values, named like registry values of FlexConfirmMail
+// for Outlook.
+type PolicyValues interface {
+	GetIntegerValue(name string) (uint64, error)
+	GetStringValue(name string) (string, error)
+	GetStringsValue(name string) ([]string, error)
+}
+
+// Implemented by sources which can have structured values natively. Others
+// should have them as JSON strings.
+type StructuredPolicyValues interface {
+	GetStructuredValue(name string) (interface{}, error)
+}
+
+// Implemented by sources which can enumerate their values, for validation.
+type ListablePolicyValues interface {
+	ListPolicyValues() ([]PolicyValueInfo, error)
+}
+
+type PolicyValueInfo struct {
+	Name string
+	Type string // native type in the source, like "REG_DWORD" or "number"
+	Data interface{}
+}
+
+func GetPolicyValue(values PolicyValues, name string, valueType string) (interface{}, error) {
+	switch valueType {
+	case POLICY_TYPE_BOOL:
+		data, err := values.GetIntegerValue(name)
+		return data == 1, err
+	case POLICY_TYPE_INTEGER:
+		return values.GetIntegerValue(name)
+	case POLICY_TYPE_STRING:
+		return values.GetStringValue(name)
+	case POLICY_TYPE_STRINGS:
+		return values.GetStringsValue(name)
+	case POLICY_TYPE_JSON:
+		var data interface{}
+		var err error
+		if structuredValues, ok := values.(StructuredPolicyValues); ok {
+			data, err = structuredValues.GetStructuredValue(name)
+		} else {
+			data, err = values.GetStringValue(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if serialized, isString := data.(string); isString {
+			if err := json.Unmarshal([]byte(serialized), &data); err != nil {
+				return nil, fmt.Errorf("%s: invalid JSON: %s", name, err.Error())
+			}
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s: unknown type %s", name, valueType)
+}
+
+// Returns names of applied configs.
+func ApplyOutlookGPOConfigs(values PolicyValues, configs TbStyleConfigs) []string {
+	applied := []string{}
+	for _, mapping := range PolicyMappings {
+		data, err := GetPolicyValue(values, mapping.Name, mapping.Type)
+		if err != nil {
+			LogForDebug("Failed to get data of the value " + mapping.Name)
+			continue
+		}
+		LogForDebug(fmt.Sprintf("Successfully got data of the value %s: %v", mapping.Name, data))
+		configs[mapping.ConfigKey] = data
+		applied = append(applied, mapping.ConfigKey)
+	}
+	return applied
+}
+
+// Policy values in a JSON file. Integer values can be given as numbers or
+// booleans, and multi-string values as arrays of strings.
+type JSONPolicyValues map[string]json.RawMessage
+
+func (values JSONPolicyValues) GetIntegerValue(name string) (uint64, error) {
+	value, found := values[name]
+	if !found {
+		return 0, fmt.Errorf("%s: not found", name)
+	}
+	var boolValue bool
+	if err := json.Unmarshal(value, &boolValue); err == nil {
+		if boolValue {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	var intValue uint64
+	if err := json.Unmarshal(value, &intValue); err != nil {
+		return 0, fmt.Errorf("%s: not an integer: %s", name, string(value))
+	}
+	return intValue, nil
+}
+
+func (values JSONPolicyValues) GetStringsValue(name string) ([]string, error) {
+	value, found := values[name]
+	if !found {
+		return nil, fmt.Errorf("%s: not found", name)
+	}
+	var stringsValue []string
+	if err := json.Unmarshal(value, &stringsValue); err != nil {
+		return nil, fmt.Errorf("%s: not an array of strings: %s", name, string(value))
+	}
+	return stringsValue, nil
+}
+
+func (values JSONPolicyValues) GetStringValue(name string) (string, error) {
+	value, found := values[name]
+	if !found {
+		return "", fmt.Errorf("%s: not found", name)
+	}
+	var stringValue string
+	if err := json.Unmarshal(value, &stringValue); err != nil {
+		return "", fmt.Errorf("%s: not a string: %s", name, string(value))
+	}
+	return stringValue, nil
+}
+
+func (values JSONPolicyValues) GetStructuredValue(name string) (interface{}, error) {
+	value, found := values[name]
+	if !found {
+		return nil, fmt.Errorf("%s: not found", name)
+	}
+	var structuredValue interface{}
+	if err := json.Unmarshal(value, &structuredValue); err != nil {
+		return nil, err
+	}
+	return structuredValue, nil
+}
+
+func (values JSONPolicyValues) ListPolicyValues() ([]PolicyValueInfo, error) {
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := []PolicyValueInfo{}
+	for _, name := range names {
+		data, err := values.GetStructuredValue(name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, PolicyValueInfo{name, JSONValueType(values[name]), data})
+	}
+	return infos, nil
+}
+
+type JSONPolicy struct {
+	Default JSONPolicyValues `json:"Default"`
+	Locked  JSONPolicyValues `json:"Locked"`
+}
+
+func ReadJSONPolicyFile(path string) (*JSONPolicy, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &JSONPolicy{}
+	if err := json.Unmarshal(buffer, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Default and Locked policy values from one place. The name is reported as
+// the provenance of values.
+type PolicySource struct {
+	Name    string
+	Default PolicyValues
+	Locked  PolicyValues
+}
+
+func ApplyPolicyValues(values PolicyValues, sourceName string, configs TbStyleConfigs, sources *map[string]string) {
+	if values == nil {
+		return
+	}
+	for _, name := range ApplyOutlookGPOConfigs(values, configs) {
+		if *sources == nil {
+			*sources = map[string]string{}
+		}
+		(*sources)[name] = sourceName
+	}
+}
+
+// For Default, later sources win: the user source overrides system sources.
+// For Locked, system sources win: users cannot override values locked by
+// administrators.
+func ApplyPolicySources(systemSources []*PolicySource, userSource *PolicySource) OutlookGPOConfigsResponse {
+	response := OutlookGPOConfigsResponse{
+		Default: TbStyleConfigs{},
+		Locked:  TbStyleConfigs{},
+	}
+	for _, source := range systemSources {
+		ApplyPolicyValues(source.Default, source.Name, response.Default, &response.DefaultSources)
+	}
+	if userSource != nil {
+		ApplyPolicyValues(userSource.Default, userSource.Name, response.Default, &response.DefaultSources)
+		ApplyPolicyValues(userSource.Locked, userSource.Name, response.Locked, &response.LockedSources)
+	}
+	for _, source := range systemSources {
+		ApplyPolicyValues(source.Locked, source.Name, response.Locked, &response.LockedSources)
+	}
+	return response
+}
+
+// Policy sources on the platform. Problems are descriptions of broken
+// sources, ignored on reading.
+type PolicySources struct {
+	System   []*PolicySource
+	User     *PolicySource
+	Problems []string
+	closers  []func()
+}
+
+func (sources *PolicySources) Apply() OutlookGPOConfigsResponse {
+	response := ApplyPolicySources(sources.System, sources.User)
+	response.Problems = sources.Problems
+	return response
+}
+
+func (sources *PolicySources) Close() {
+	for _, closer := range sources.closers {
+		closer()
+	}
+}
+
+func (sources *PolicySources) AddProblem(problem string) {
+	LogForWarn(problem)
+	sources.Problems = append(sources.Problems, problem)
+}
+
+func ReadOutlookGPOConfigs() (OutlookGPOConfigsResponse, *HostError) {
+	sources := OpenPolicySources()
+	defer sources.Close()
+	return sources.Apply(), nil
+}
+
+// Reads policy files in the system directory in the lexical order, and the
+// user file.
+func OpenJSONPolicySources(systemDir string, userFile string) *PolicySources {
+	sources := &PolicySources{System: []*PolicySource{}}
+	systemFiles, _ := filepath.Glob(filepath.Join(systemDir, "*.json"))
+	sort.Strings(systemFiles)
+	for _, path := range systemFiles {
+		LogForDebug("Read policy from " + path)
+		policy, err := ReadJSONPolicyFile(path)
+		if err != nil {
+			sources.AddProblem("Failed to read policy from " + path + ": " + err.Error())
+			continue
+		}
+		sources.System = append(sources.System, &PolicySource{path, policy.Default, policy.Locked})
+	}
+
+	if userFile != "" {
+		LogForDebug("Read policy from " + userFile)
+		policy, err := ReadJSONPolicyFile(userFile)
+		if err == nil {
+			sources.User = &PolicySource{userFile, policy.Default, policy.Locked}
+		} else if os.IsNotExist(err) {
+			LogForDebug("Failed to read policy from " + userFile + ": " + err.Error())
+		} else {
+			sources.AddProblem("Failed to read policy from " + userFile + ": " + err.Error())
+		}
+	}
+	return sources
+}
+
+func ReadJSONPolicies(systemDir string, userFile string) OutlookGPOConfigsResponse {
+	return OpenJSONPolicySources(systemDir, userFile).Apply()
+}
@@ -0,0 +1,116 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"math"
+)
+
+const (
+	POLICY_TYPE_BOOL    = "bool"    // integer, 1 means true
+	POLICY_TYPE_INTEGER = "integer" // DWORD or QWORD
+	POLICY_TYPE_STRING  = "string"
+	POLICY_TYPE_STRINGS = "strings" // REG_MULTI_SZ
+	POLICY_TYPE_JSON    = "json"    // structured value, or a JSON string
+)
+
+type PolicyMapping struct {
+	Name      string // name of the registry value
+	ConfigKey string // key of TbStyleConfigs
+	Type      string
+}
+
+// Mappings from policy values to configs. Values named like FlexConfirmMail
+// for Outlook come first, and values named like configs of FlexConfirmMail
+// for Thunderbird (see doc/flexconfirmmail.json and
+// managed-storage-examples/policies.json) override them if both are given.
+// Items of built-in rules are given as "<capitalized rule ID>Items".
+var PolicyMappings = []PolicyMapping{
+	// FlexConfirmMail for Outlook
+	{"CountAllowSkip", "CountdownAllowSkip", POLICY_TYPE_BOOL},
+	{"CountEnabled", "ShowCountdown", POLICY_TYPE_BOOL},
+	{"CountSeconds", "CountdownSeconds", POLICY_TYPE_INTEGER},
+	{"MainSkipIfNoExt", "SkipConfirmationForInternalMail", POLICY_TYPE_BOOL},
+	{"SafeBccEnabled", "ConfirmMultipleRecipientDomains", POLICY_TYPE_BOOL},
+	{"SafeBccThreshold", "MinConfirmMultipleRecipientDomainsCount", POLICY_TYPE_INTEGER},
+	{"TrustedDomains", "FixedInternalDomains", POLICY_TYPE_STRINGS},
+	{"UnsafeDomains", "BuiltInAttentionDomainsItems", POLICY_TYPE_STRINGS},
+	{"UnsafeFiles", "BuiltInAttentionTermsItems", POLICY_TYPE_STRINGS},
+
+	// Recipients
+	{"ConfirmationMode", "ConfirmationMode", POLICY_TYPE_INTEGER},
+	{"InternalDomains", "InternalDomains", POLICY_TYPE_STRINGS},
+	{"FixedInternalDomains", "FixedInternalDomains", POLICY_TYPE_STRINGS},
+	{"SkipConfirmationForInternalMail", "SkipConfirmationForInternalMail", POLICY_TYPE_BOOL},
+	{"MinConfirmationRecipientsCount", "MinConfirmationRecipientsCount", POLICY_TYPE_INTEGER},
+	{"ConfirmMultipleRecipientDomains", "ConfirmMultipleRecipientDomains", POLICY_TYPE_BOOL},
+	{"MinConfirmMultipleRecipientDomainsCount", "MinConfirmMultipleRecipientDomainsCount", POLICY_TYPE_INTEGER},
+	{"ConfirmNewDomainRecipients", "ConfirmNewDomainRecipients", POLICY_TYPE_BOOL},
+	{"AllowCheckAllInternals", "AllowCheckAllInternals", POLICY_TYPE_BOOL},
+	{"AllowCheckAllExternals", "AllowCheckAllExternals", POLICY_TYPE_BOOL},
+
+	// Attention domains
+	{"AttentionDomainsSource", "AttentionDomainsSource", POLICY_TYPE_INTEGER},
+	{"AttentionDomains", "AttentionDomains", POLICY_TYPE_STRINGS},
+	{"AttentionDomainsFile", "AttentionDomainsFile", POLICY_TYPE_STRING},
+	{"AttentionDomainsHighlightMode", "AttentionDomainsHighlightMode", POLICY_TYPE_INTEGER},
+	{"AttentionDomainsConfirmationMode", "AttentionDomainsConfirmationMode", POLICY_TYPE_INTEGER},
+	{"AttentionDomainsDialogMessage", "AttentionDomainsDialogMessage", POLICY_TYPE_STRING},
+
+	// Attachments
+	{"AttentionSuffixesConfirm", "AttentionSuffixesConfirm", POLICY_TYPE_BOOL},
+	{"AttentionSuffixesSource", "AttentionSuffixesSource", POLICY_TYPE_INTEGER},
+	{"AttentionSuffixes", "AttentionSuffixes", POLICY_TYPE_STRINGS},
+	{"AttentionSuffixesFile", "AttentionSuffixesFile", POLICY_TYPE_STRING},
+	{"AttentionSuffixesDialogMessage", "AttentionSuffixesDialogMessage", POLICY_TYPE_STRING},
+	{"RequireReinputAttachmentNames", "RequireReinputAttachmentNames", POLICY_TYPE_BOOL},
+	{"AllowCheckAllAttachments", "AllowCheckAllAttachments", POLICY_TYPE_BOOL},
+
+	// Others
+	{"ShowCountdown", "ShowCountdown", POLICY_TYPE_BOOL},
+	{"CountdownSeconds", "CountdownSeconds", POLICY_TYPE_INTEGER},
+	{"CountdownAllowSkip", "CountdownAllowSkip", POLICY_TYPE_BOOL},
+	{"RequireCheckSubject", "RequireCheckSubject", POLICY_TYPE_BOOL},
+	{"RequireCheckBody", "RequireCheckBody", POLICY_TYPE_BOOL},
+	{"HighlightExternalDomains", "HighlightExternalDomains", POLICY_TYPE_BOOL},
+	{"LargeFontSizeForAddresses", "LargeFontSizeForAddresses", POLICY_TYPE_BOOL},
+	{"AlwaysLargeDialog", "AlwaysLargeDialog", POLICY_TYPE_BOOL},
+	{"TopMessage", "TopMessage", POLICY_TYPE_STRING},
+	{"EmphasizeTopMessage", "EmphasizeTopMessage", POLICY_TYPE_BOOL},
+	{"EmphasizeRecipientType", "EmphasizeRecipientType", POLICY_TYPE_BOOL},
+	{"ConfirmMultipleRecipientDomainsDialogMessage", "ConfirmMultipleRecipientDomainsDialogMessage", POLICY_TYPE_STRING},
+	{"ConfirmDialogFields", "ConfirmDialogFields", POLICY_TYPE_STRINGS},
+	{"ExtraStyleRules", "ExtraStyleRules", POLICY_TYPE_STRING},
+	{"Debug", "Debug", POLICY_TYPE_BOOL},
+
+	// Rules
+	{"BuiltInAttentionDomainsItems", "BuiltInAttentionDomainsItems", POLICY_TYPE_STRINGS},
+	{"BuiltInAttentionSuffixesItems", "BuiltInAttentionSuffixesItems", POLICY_TYPE_STRINGS},
+	{"BuiltInAttentionSuffixes2Items", "BuiltInAttentionSuffixes2Items", POLICY_TYPE_STRINGS},
+	{"BuiltInAttentionTermsItems", "BuiltInAttentionTermsItems", POLICY_TYPE_STRINGS},
+	{"BuiltInBlockedDomainsItems", "BuiltInBlockedDomainsItems", POLICY_TYPE_STRINGS},
+	{"UserRules", "UserRules", POLICY_TYPE_JSON},
+}
+
+// Valid values of integer configs, checked by the validate-policy command.
+// Values in Extra are also valid.
+type PolicyIntegerRange struct {
+	Min   uint64
+	Max   uint64
+	Extra []uint64
+}
+
+var PolicyIntegerRanges = map[string]PolicyIntegerRange{
+	"ConfirmationMode":                        {0, 2, nil}, // CONFIRMATION_MODE_* in constants.js
+	"MinConfirmationRecipientsCount":          {0, math.MaxInt32, nil},
+	"MinConfirmMultipleRecipientDomainsCount": {1, math.MaxInt32, nil},
+	"AttentionDomainsSource":                  {0, 1, nil},                      // SOURCE_*
+	"AttentionDomainsHighlightMode":           {0, 4, nil},                      // HIGHLIGHT_*
+	"AttentionDomainsConfirmationMode":        {0, 4, []uint64{10, 20, 30, 40}}, // ACTION_*
+	"AttentionSuffixesSource":                 {0, 1, nil},
+	"CountdownSeconds":                        {0, math.MaxInt32, nil},
+}
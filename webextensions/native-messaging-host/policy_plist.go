@@ -0,0 +1,165 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"howett.net/plist"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+const PLIST_POLICY_DOMAIN = "com.clear-code.FlexConfirmMail"
+
+// Policy values in a plist file. Integer values can be given as integers or
+// booleans, and multi-string values as arrays of strings.
+type PlistPolicyValues map[string]interface{}
+
+func (values PlistPolicyValues) GetIntegerValue(name string) (uint64, error) {
+	value, found := values[name]
+	if !found {
+		return 0, fmt.Errorf("%s: not found", name)
+	}
+	switch typedValue := value.(type) {
+	case bool:
+		if typedValue {
+			return 1, nil
+		}
+		return 0, nil
+	case uint64:
+		return typedValue, nil
+	case int64:
+		if typedValue >= 0 {
+			return uint64(typedValue), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: not an integer: %v", name, value)
+}
+
+func (values PlistPolicyValues) GetStringsValue(name string) ([]string, error) {
+	value, found := values[name]
+	if !found {
+		return nil, fmt.Errorf("%s: not found", name)
+	}
+	array, isArray := value.([]interface{})
+	if !isArray {
+		return nil, fmt.Errorf("%s: not an array of strings: %v", name, value)
+	}
+	stringsValue := []string{}
+	for _, item := range array {
+		stringItem, isString := item.(string)
+		if !isString {
+			return nil, fmt.Errorf("%s: not an array of strings: %v", name, value)
+		}
+		stringsValue = append(stringsValue, stringItem)
+	}
+	return stringsValue, nil
+}
+
+func (values PlistPolicyValues) GetStringValue(name string) (string, error) {
+	value, found := values[name]
+	if !found {
+		return "", fmt.Errorf("%s: not found", name)
+	}
+	stringValue, isString := value.(string)
+	if !isString {
+		return "", fmt.Errorf("%s: not a string: %v", name, value)
+	}
+	return stringValue, nil
+}
+
+func (values PlistPolicyValues) GetStructuredValue(name string) (interface{}, error) {
+	value, found := values[name]
+	if !found {
+		return nil, fmt.Errorf("%s: not found", name)
+	}
+	return value, nil
+}
+
+func (values PlistPolicyValues) ListPolicyValues() ([]PolicyValueInfo, error) {
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := []PolicyValueInfo{}
+	for _, name := range names {
+		infos = append(infos, PolicyValueInfo{name, PlistValueType(values[name]), values[name]})
+	}
+	return infos, nil
+}
+
+// Returns names of types same to elements in plist files.
+func PlistValueType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case uint64, int64:
+		return "integer"
+	case float32, float64:
+		return "real"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "dict"
+	case []byte:
+		return "data"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+type PlistPolicy struct {
+	Default PlistPolicyValues `plist:"Default"`
+	Locked  PlistPolicyValues `plist:"Locked"`
+}
+
+// Reads a plist file in the XML or the binary format.
+func ReadPlistPolicyFile(path string) (*PlistPolicy, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &PlistPolicy{}
+	if _, err := plist.Unmarshal(buffer, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Reads managed preferences for the computer and the user.
+func OpenPlistPolicySources(systemFile string, userFile string) *PolicySources {
+	sources := &PolicySources{System: []*PolicySource{}}
+	for _, path := range []string{systemFile, userFile} {
+		if path == "" {
+			continue
+		}
+		LogForDebug("Read policy from " + path)
+		policy, err := ReadPlistPolicyFile(path)
+		if os.IsNotExist(err) {
+			LogForDebug("Failed to read policy from " + path + ": " + err.Error())
+			continue
+		}
+		if err != nil {
+			sources.AddProblem("Failed to read policy from " + path + ": " + err.Error())
+			continue
+		}
+		source := &PolicySource{path, policy.Default, policy.Locked}
+		if path == systemFile {
+			sources.System = append(sources.System, source)
+		} else {
+			sources.User = source
+		}
+	}
+	return sources
+}
+
+func ReadPlistPolicies(systemFile string, userFile string) OutlookGPOConfigsResponse {
+	return OpenPlistPolicySources(systemFile, userFile).Apply()
+}
@@ -0,0 +1,61 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPlistPolicyFile_XML(t *testing.T) {
+	policy, err := ReadPlistPolicyFile(filepath.Join("testdata", "policy-system.plist"))
+	assert.Nil(t, err)
+
+	countEnabled, err := policy.Default.GetIntegerValue("CountEnabled")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), countEnabled)
+	trustedDomains, err := policy.Default.GetStringsValue("TrustedDomains")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, trustedDomains)
+	_, err = policy.Default.GetStringsValue("CountSeconds")
+	assert.NotNil(t, err)
+}
+
+func TestReadPlistPolicyFile_Binary(t *testing.T) {
+	policy, err := ReadPlistPolicyFile(filepath.Join("testdata", "policy-user.binary.plist"))
+	assert.Nil(t, err)
+
+	countSeconds, err := policy.Default.GetIntegerValue("CountSeconds")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), countSeconds)
+	unsafeFiles, err := policy.Default.GetStringsValue("UnsafeFiles")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"secret"}, unsafeFiles)
+}
+
+func TestReadPlistPolicies(t *testing.T) {
+	response := ReadPlistPolicies(
+		filepath.Join("testdata", "policy-system.plist"),
+		filepath.Join("testdata", "policy-user.binary.plist"))
+
+	assert.Equal(t, true, response.Default["ShowCountdown"])
+	assert.Equal(t, uint64(10), response.Default["CountdownSeconds"])
+	assert.Equal(t, true, response.Default["SkipConfirmationForInternalMail"])
+	assert.Equal(t, []string{"example.com", "example.org"}, response.Default["FixedInternalDomains"])
+	assert.Equal(t, []string{"secret"}, response.Default["BuiltInAttentionTermsItems"])
+
+	assert.Equal(t, true, response.Locked["ConfirmMultipleRecipientDomains"])
+	assert.Equal(t, uint64(3), response.Locked["MinConfirmMultipleRecipientDomainsCount"])
+}
+
+func TestReadPlistPolicies_NoFiles(t *testing.T) {
+	dir := t.TempDir()
+	response := ReadPlistPolicies(filepath.Join(dir, "missing.plist"), "")
+	assert.Equal(t, TbStyleConfigs{}, response.Default)
+	assert.Equal(t, TbStyleConfigs{}, response.Locked)
+}
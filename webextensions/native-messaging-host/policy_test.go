@@ -0,0 +1,244 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func WritePolicyFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJSONPolicyValues(t *testing.T) {
+	values := JSONPolicyValues{
+		"Number":  []byte(`30`),
+		"True":    []byte(`true`),
+		"False":   []byte(`false`),
+		"Strings": []byte(`["a","b"]`),
+		"Text":    []byte(`"text"`),
+	}
+
+	number, err := values.GetIntegerValue("Number")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(30), number)
+	trueValue, err := values.GetIntegerValue("True")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), trueValue)
+	falseValue, err := values.GetIntegerValue("False")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), falseValue)
+	_, err = values.GetIntegerValue("Text")
+	assert.NotNil(t, err)
+	_, err = values.GetIntegerValue("Missing")
+	assert.NotNil(t, err)
+
+	stringsValue, err := values.GetStringsValue("Strings")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, stringsValue)
+	_, err = values.GetStringsValue("Number")
+	assert.NotNil(t, err)
+}
+
+func TestReadJSONPolicies(t *testing.T) {
+	systemDir := t.TempDir()
+	userDir := t.TempDir()
+	WritePolicyFile(t, filepath.Join(systemDir, "10-base.json"), `{
+  "Default": {"CountEnabled": 1, "CountSeconds": 3, "TrustedDomains": ["example.com"]},
+  "Locked": {"SafeBccEnabled": 1}
+}`)
+	WritePolicyFile(t, filepath.Join(systemDir, "20-override.json"), `{
+  "Default": {"CountSeconds": 5}
+}`)
+	WritePolicyFile(t, filepath.Join(systemDir, "30-broken.json"), `{`)
+	WritePolicyFile(t, filepath.Join(systemDir, "ignored.txt"), `{"Default": {"CountSeconds": 99}}`)
+	userFile := filepath.Join(userDir, "policies.json")
+	WritePolicyFile(t, userFile, `{
+  "Default": {"CountSeconds": 10, "MainSkipIfNoExt": true},
+  "Locked": {"SafeBccEnabled": 0, "SafeBccThreshold": 3}
+}`)
+
+	response := ReadJSONPolicies(systemDir, userFile)
+
+	assert.True(t, response.Default.Has("ShowCountdown"))
+	assert.Equal(t, true, response.Default["ShowCountdown"])
+	assert.Equal(t, uint64(10), response.Default["CountdownSeconds"])
+	assert.Equal(t, true, response.Default["SkipConfirmationForInternalMail"])
+	assert.Equal(t, []string{"example.com"}, response.Default["FixedInternalDomains"])
+	assert.False(t, response.Default.Has("CountdownAllowSkip"))
+
+	// Values locked by the system must not be overridden by the user.
+	assert.True(t, response.Locked.Has("ConfirmMultipleRecipientDomains"))
+	assert.Equal(t, true, response.Locked["ConfirmMultipleRecipientDomains"])
+	assert.Equal(t, uint64(3), response.Locked["MinConfirmMultipleRecipientDomainsCount"])
+
+	if assert.Len(t, response.Problems, 1) {
+		assert.Contains(t, response.Problems[0], "Failed to read policy from "+filepath.Join(systemDir, "30-broken.json"))
+	}
+}
+
+func TestReadJSONPolicies_NoFiles(t *testing.T) {
+	dir := t.TempDir()
+	response := ReadJSONPolicies(filepath.Join(dir, "missing"), filepath.Join(dir, "missing.json"))
+	assert.Equal(t, TbStyleConfigs{}, response.Default)
+	assert.Equal(t, TbStyleConfigs{}, response.Locked)
+	assert.Empty(t, response.Problems)
+}
+
+func TestApplyPolicySources_Layering(t *testing.T) {
+	machine := &PolicySource{
+		Name: "HKLM",
+		Default: JSONPolicyValues{
+			"CountEnabled": []byte(`1`),
+			"CountSeconds": []byte(`3`),
+		},
+		Locked: JSONPolicyValues{
+			"SafeBccEnabled":   []byte(`1`),
+			"SafeBccThreshold": []byte(`2`),
+		},
+	}
+	user := &PolicySource{
+		Name: "HKCU",
+		Default: JSONPolicyValues{
+			"CountSeconds":   []byte(`10`),
+			"TrustedDomains": []byte(`["example.com"]`),
+		},
+		Locked: JSONPolicyValues{
+			"SafeBccThreshold": []byte(`5`),
+			"CountAllowSkip":   []byte(`0`),
+		},
+	}
+
+	response := ApplyPolicySources([]*PolicySource{machine}, user)
+
+	assert.Equal(t, true, response.Default["ShowCountdown"])
+	assert.Equal(t, uint64(10), response.Default["CountdownSeconds"])
+	assert.Equal(t, []string{"example.com"}, response.Default["FixedInternalDomains"])
+	assert.Equal(t, map[string]string{
+		"ShowCountdown":        "HKLM",
+		"CountdownSeconds":     "HKCU",
+		"FixedInternalDomains": "HKCU",
+	}, response.DefaultSources)
+
+	assert.Equal(t, true, response.Locked["ConfirmMultipleRecipientDomains"])
+	assert.Equal(t, uint64(2), response.Locked["MinConfirmMultipleRecipientDomainsCount"])
+	assert.True(t, response.Locked.Has("CountdownAllowSkip"))
+	assert.Equal(t, false, response.Locked["CountdownAllowSkip"])
+	assert.Equal(t, map[string]string{
+		"ConfirmMultipleRecipientDomains":         "HKLM",
+		"MinConfirmMultipleRecipientDomainsCount": "HKLM",
+		"CountdownAllowSkip":                      "HKCU",
+	}, response.LockedSources)
+}
+
+func TestApplyPolicySources_MissingKeys(t *testing.T) {
+	machine := &PolicySource{Name: "HKLM"}
+	user := &PolicySource{Name: "HKCU", Locked: JSONPolicyValues{"CountEnabled": []byte(`1`)}}
+
+	response := ApplyPolicySources([]*PolicySource{machine}, user)
+
+	assert.Equal(t, TbStyleConfigs{}, response.Default)
+	assert.Nil(t, response.DefaultSources)
+	assert.Equal(t, true, response.Locked["ShowCountdown"])
+	assert.Equal(t, map[string]string{"ShowCountdown": "HKCU"}, response.LockedSources)
+}
+
+func TestApplyOutlookGPOConfigs_StructuredValues(t *testing.T) {
+	values := JSONPolicyValues{
+		"ConfirmationMode":           []byte(`2`),
+		"TopMessage":                 []byte(`"Check recipients"`),
+		"ConfirmDialogFields":        []byte(`["externals","internals"]`),
+		"BuiltInBlockedDomainsItems": []byte(`["danger.example.com"]`),
+		"UserRules":                  []byte(`[{"id":"rule-1","enabled":true,"itemsLocal":["secret"]}]`),
+	}
+	configs := TbStyleConfigs{}
+	ApplyOutlookGPOConfigs(values, configs)
+
+	assert.Equal(t, uint64(2), configs["ConfirmationMode"])
+	assert.Equal(t, "Check recipients", configs["TopMessage"])
+	assert.Equal(t, []string{"externals", "internals"}, configs["ConfirmDialogFields"])
+	assert.Equal(t, []string{"danger.example.com"}, configs["BuiltInBlockedDomainsItems"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": "rule-1", "enabled": true, "itemsLocal": []interface{}{"secret"}},
+	}, configs["UserRules"])
+
+	// Rules can be given as a JSON string, like REG_SZ values.
+	configs = TbStyleConfigs{}
+	ApplyOutlookGPOConfigs(JSONPolicyValues{"UserRules": []byte(`"[{\"id\":\"rule-1\"}]"`)}, configs)
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "rule-1"}}, configs["UserRules"])
+}
+
+func TestApplyOutlookGPOConfigs_OverrideOutlookStyleName(t *testing.T) {
+	configs := TbStyleConfigs{}
+	ApplyOutlookGPOConfigs(JSONPolicyValues{
+		"CountSeconds":     []byte(`3`),
+		"CountdownSeconds": []byte(`10`),
+	}, configs)
+	assert.Equal(t, uint64(10), configs["CountdownSeconds"])
+}
+
+func TestTbStyleConfigs_MarshalJSON(t *testing.T) {
+	configs := TbStyleConfigs{"ShowCountdown": true, "CountdownSeconds": uint64(5)}
+	marshalled, err := json.Marshal(configs)
+	assert.Nil(t, err)
+	assert.Equal(t,
+		`{"CountdownSeconds":5,"HasCountdownSeconds":true,"HasShowCountdown":true,"ShowCountdown":true}`,
+		string(marshalled))
+
+	marshalled, err = json.Marshal(TbStyleConfigs(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, `{}`, string(marshalled))
+}
+
+func TestPolicyMappings_CoverAllConfigs(t *testing.T) {
+	mappedKeys := map[string]bool{}
+	for _, mapping := range PolicyMappings {
+		mappedKeys[mapping.ConfigKey] = true
+	}
+	ignoredKeys := map[string]bool{
+		"__ConfigsMigration__userValeusSameToDefaultAreCleared": true,
+		"configsVersion": true,
+	}
+	assertMapped := func(key string) {
+		if strings.HasPrefix(key, "//") || strings.HasSuffix(key, ":locked") || ignoredKeys[key] {
+			return
+		}
+		assert.True(t, mappedKeys[strings.ToUpper(key[:1])+key[1:]], "config %s should be mapped", key)
+	}
+
+	var exported map[string]interface{}
+	buffer, err := ioutil.ReadFile(filepath.Join("..", "..", "doc", "flexconfirmmail.json"))
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(buffer, &exported))
+	for key := range exported {
+		assertMapped(key)
+	}
+
+	var policies struct {
+		Policies struct {
+			ThirdParty struct {
+				Extensions map[string]map[string]interface{} `json:"Extensions"`
+			} `json:"3rdparty"`
+		} `json:"policies"`
+	}
+	buffer, err = ioutil.ReadFile(filepath.Join("..", "managed-storage-examples", "policies.json"))
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(buffer, &policies))
+	for _, configs := range policies.Policies.ThirdParty.Extensions {
+		for key := range configs {
+			assertMapped(key)
+		}
+	}
+}
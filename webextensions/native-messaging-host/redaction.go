@@ -0,0 +1,81 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	REDACTED_HOME = "<home>"
+	REDACTED_USER = "<user>"
+	REDACTED_TERM = "<redacted>"
+)
+
+// Logs are attached to public bug reports, so personal information is
+// masked unless "unredacted" is requested for on-site investigation.
+var RedactLogs = true
+var SensitiveTermsMatcher *regexp.Regexp
+
+// Separators may be escaped in JSON strings, like "C:\\Users\\name".
+var UserProfilePathMatcher = regexp.MustCompile(`(?i)([a-z]:\\{1,2}users\\{1,2}|/home/|/users/)[^\\/\s"':;,]+`)
+
+var EmailAddressMatcher = regexp.MustCompile(`[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@([a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)+)`)
+
+func SetSensitiveTerms(terms []string) {
+	patterns := []string{}
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			patterns = append(patterns, regexp.QuoteMeta(term))
+		}
+	}
+	if len(patterns) == 0 {
+		SensitiveTermsMatcher = nil
+		return
+	}
+	SensitiveTermsMatcher = regexp.MustCompile(`(?i)` + strings.Join(patterns, "|"))
+}
+
+func RedactLogMessage(message string) string {
+	if !RedactLogs {
+		return message
+	}
+	if SensitiveTermsMatcher != nil {
+		message = SensitiveTermsMatcher.ReplaceAllString(message, REDACTED_TERM)
+	}
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		message = strings.ReplaceAll(message, home, REDACTED_HOME)
+	}
+	message = UserProfilePathMatcher.ReplaceAllString(message, "${1}"+REDACTED_USER)
+	return EmailAddressMatcher.ReplaceAllStringFunc(message, func(address string) string {
+		if IsExtensionIDForLog(address) {
+			return address
+		}
+		return "***" + address[strings.LastIndex(address, "@"):]
+	})
+}
+
+// IDs of add-ons look like email addresses, but they are required to audit
+// callers.
+func IsExtensionIDForLog(address string) bool {
+	if address == CurrentLogContext.CallerID {
+		return true
+	}
+	allowedIDs := DEFAULT_ALLOWED_CALLER_IDS
+	// GetAccessPolicy() is not used, because it may log while loading.
+	if CurrentAccessPolicy != nil {
+		allowedIDs = append(append([]string{}, allowedIDs...), CurrentAccessPolicy.CallerIDs...)
+	}
+	for _, allowedID := range allowedIDs {
+		if address == allowedID {
+			return true
+		}
+	}
+	return false
+}
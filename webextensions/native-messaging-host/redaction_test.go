@@ -0,0 +1,81 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactLogMessage(t *testing.T) {
+	t.Cleanup(func() {
+		RedactLogs = true
+		SetSensitiveTerms(nil)
+	})
+	RedactLogs = true
+
+	assert.Equal(t, `Read policy from C:\Users\<user>\AppData\Roaming\list.txt`,
+		RedactLogMessage(`Read policy from C:\Users\alice\AppData\Roaming\list.txt`))
+	assert.Equal(t, `Params: {"path":"C:\\Users\\<user>\\list.txt"}`,
+		RedactLogMessage(`Params: {"path":"C:\\Users\\alice\\list.txt"}`))
+	assert.Equal(t, "Read /home/<user>/.config and /Users/<user>/Library",
+		RedactLogMessage("Read /home/alice/.config and /Users/bob/Library"))
+	assert.Equal(t, "Recipients: ***@example.com, ***@sub.example.jp",
+		RedactLogMessage("Recipients: alice.smith+tag@example.com, bob@sub.example.jp"))
+
+	if home, err := os.UserHomeDir(); err == nil {
+		assert.Equal(t, "Read "+filepath.Join(REDACTED_HOME, "list.txt"),
+			RedactLogMessage("Read "+filepath.Join(home, "list.txt")))
+	}
+
+	SetSensitiveTerms([]string{"Project X", " ", "secret.example.com"})
+	assert.Equal(t, "Domains: <redacted> <redacted> example.org",
+		RedactLogMessage("Domains: project x SECRET.example.com example.org"))
+	SetSensitiveTerms([]string{})
+	assert.Nil(t, SensitiveTermsMatcher)
+
+	RedactLogs = false
+	assert.Equal(t, "Read /home/alice/list.txt from bob@example.com",
+		RedactLogMessage("Read /home/alice/list.txt from bob@example.com"))
+}
+
+func TestLogAtLevel_Redacted(t *testing.T) {
+	t.Cleanup(ResetDebugLogs)
+	ResetDebugLogs()
+	LogForDebug("Caller is bob@example.com")
+	assert.Equal(t, "Caller is ***@example.com", DebugLogs[0].Message)
+}
+
+func TestRedactLogMessage_CallerID(t *testing.T) {
+	t.Cleanup(func() {
+		CurrentLogContext = LogContext{}
+	})
+	assert.Equal(t, "Command:fetch from flexible-confirm-mail@clear-code.com",
+		RedactLogMessage("Command:fetch from flexible-confirm-mail@clear-code.com"))
+
+	CurrentLogContext = LogContext{CallerID: "unknown-addon@example.com"}
+	assert.Equal(t, "Caller is not allowed: unknown-addon@example.com",
+		RedactLogMessage("Caller is not allowed: unknown-addon@example.com"))
+
+	UseAccessPolicy(t, &AccessPolicy{CallerIDs: []string{"custom@example.org"}})
+	assert.Equal(t, "Allowed: custom@example.org, recipient: ***@example.org",
+		RedactLogMessage("Allowed: custom@example.org, recipient: alice@example.org"))
+}
+
+func TestCheckCaller_LogsCallerID(t *testing.T) {
+	t.Cleanup(func() {
+		ResetDebugLogs()
+		CurrentLogContext = LogContext{}
+	})
+	UseAccessPolicy(t, nil)
+	ResetDebugLogs()
+	CurrentLogContext = LogContext{CallerID: "evil@example.com"}
+	assert.NotNil(t, CheckCaller("evil@example.com"))
+	assert.Equal(t, "Caller is not allowed: evil@example.com", DebugLogs[len(DebugLogs)-1].Message)
+}
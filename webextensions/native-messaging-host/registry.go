@@ -0,0 +1,295 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	REGISTRY_HIVE_LOCAL_MACHINE = "HKLM"
+	REGISTRY_HIVE_CURRENT_USER  = "HKCU"
+)
+
+const REGISTRY_POLICY_KEY_PATH = `SOFTWARE\Policies\FlexConfirmMail`
+const REGISTRY_ACCESS_POLICY_KEY_PATH = REGISTRY_POLICY_KEY_PATH + `\NativeMessagingHost`
+
+// Same to value types defined in winnt.h.
+const (
+	REG_TYPE_SZ        = 1
+	REG_TYPE_EXPAND_SZ = 2
+	REG_TYPE_BINARY    = 3
+	REG_TYPE_DWORD     = 4
+	REG_TYPE_MULTI_SZ  = 7
+	REG_TYPE_QWORD     = 11
+)
+
+func RegistryValueTypeName(valueType uint32) string {
+	switch valueType {
+	case REG_TYPE_SZ:
+		return "REG_SZ"
+	case REG_TYPE_EXPAND_SZ:
+		return "REG_EXPAND_SZ"
+	case REG_TYPE_BINARY:
+		return "REG_BINARY"
+	case REG_TYPE_DWORD:
+		return "REG_DWORD"
+	case REG_TYPE_MULTI_SZ:
+		return "REG_MULTI_SZ"
+	case REG_TYPE_QWORD:
+		return "REG_QWORD"
+	}
+	return fmt.Sprintf("REG_TYPE_%d", valueType)
+}
+
+var ErrRegistryNotExist = errors.New("the system cannot find the file specified")
+var ErrRegistryUnexpectedType = errors.New("unexpected key value type")
+
+type RegistryKey interface {
+	PolicyValues
+	Close() error
+}
+
+// Read only access to the Windows registry, or its replacement.
+type Registry interface {
+	OpenKey(hive string, path string) (RegistryKey, error)
+}
+
+func OpenRegistryPolicySource(registry Registry, hive string, sources *PolicySources) *PolicySource {
+	LogForDebug(`Read GPO configs from ` + hive + `\` + REGISTRY_POLICY_KEY_PATH)
+	source := &PolicySource{Name: hive}
+	for _, section := range []string{"Default", "Locked"} {
+		keyPath := REGISTRY_POLICY_KEY_PATH + `\` + section
+		key, err := registry.OpenKey(hive, keyPath)
+		if errors.Is(err, ErrRegistryNotExist) {
+			LogForDebug("Failed to open key " + keyPath)
+			continue
+		}
+		if err != nil {
+			sources.AddProblem("Failed to open key " + hive + `\` + keyPath + ": " + err.Error())
+			continue
+		}
+		sources.closers = append(sources.closers, func() { key.Close() })
+		if section == "Default" {
+			source.Default = key
+		} else {
+			source.Locked = key
+		}
+	}
+	return source
+}
+
+func OpenRegistryPolicySources(registry Registry) *PolicySources {
+	sources := &PolicySources{}
+	sources.System = []*PolicySource{OpenRegistryPolicySource(registry, REGISTRY_HIVE_LOCAL_MACHINE, sources)}
+	sources.User = OpenRegistryPolicySource(registry, REGISTRY_HIVE_CURRENT_USER, sources)
+	return sources
+}
+
+// Values in HKCU override ones in HKLM for Default, but values in HKLM win
+// for Locked.
+func ReadRegistryPolicies(registry Registry) OutlookGPOConfigsResponse {
+	sources := OpenRegistryPolicySources(registry)
+	defer sources.Close()
+	return sources.Apply()
+}
+
+// Only administrators can write to HKLM. Returns nil if there is no policy.
+// Values with wrong types are errors, not to allow everything.
+func ReadRegistryAccessPolicy(registry Registry) (*AccessPolicy, error) {
+	LogForDebug(`Read access policy from HKLM\` + REGISTRY_ACCESS_POLICY_KEY_PATH)
+	key, err := registry.OpenKey(REGISTRY_HIVE_LOCAL_MACHINE, REGISTRY_ACCESS_POLICY_KEY_PATH)
+	if errors.Is(err, ErrRegistryNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+
+	policy := &AccessPolicy{}
+	values := []struct {
+		name string
+		data *[]string
+	}{
+		{"AllowedDirectories", &policy.Directories},
+		{"AllowedPatterns", &policy.Patterns},
+		{"AllowedExtensions", &policy.Extensions},
+		{"AllowedURLPrefixes", &policy.URLPrefixes},
+		{"AllowedCallerIDs", &policy.CallerIDs},
+	}
+	for _, value := range values {
+		data, err := key.GetStringsValue(value.name)
+		if errors.Is(err, ErrRegistryNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", value.name, err)
+		}
+		*value.data = data
+	}
+	if len(policy.Directories) == 0 && len(policy.Patterns) == 0 &&
+		len(policy.Extensions) == 0 && len(policy.URLPrefixes) == 0 &&
+		len(policy.CallerIDs) == 0 {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+type RegistryValue struct {
+	Type uint32
+	Data interface{} // string, []string, uint64 or []byte
+}
+
+// In-memory registry. Key paths and value names are case-insensitive, like
+// the Windows registry.
+type MemoryRegistry struct {
+	keys map[string]*MemoryRegistryKey
+}
+
+type MemoryRegistryKey struct {
+	values map[string]RegistryValue
+	names  map[string]string
+}
+
+func NewMemoryRegistryKey() *MemoryRegistryKey {
+	return &MemoryRegistryKey{values: map[string]RegistryValue{}, names: map[string]string{}}
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{keys: map[string]*MemoryRegistryKey{}}
+}
+
+func NormalizeRegistryHive(hive string) string {
+	switch strings.ToUpper(hive) {
+	case "HKEY_LOCAL_MACHINE", REGISTRY_HIVE_LOCAL_MACHINE:
+		return REGISTRY_HIVE_LOCAL_MACHINE
+	case "HKEY_CURRENT_USER", REGISTRY_HIVE_CURRENT_USER:
+		return REGISTRY_HIVE_CURRENT_USER
+	}
+	return strings.ToUpper(hive)
+}
+
+func memoryRegistryKeyName(hive string, path string) string {
+	return NormalizeRegistryHive(hive) + `\` + strings.ToLower(strings.Trim(path, `\`))
+}
+
+func (registry *MemoryRegistry) CreateKey(hive string, path string) *MemoryRegistryKey {
+	name := memoryRegistryKeyName(hive, path)
+	key, found := registry.keys[name]
+	if !found {
+		key = NewMemoryRegistryKey()
+		registry.keys[name] = key
+	}
+	return key
+}
+
+// Deletes the key and its subkeys.
+func (registry *MemoryRegistry) DeleteKey(hive string, path string) {
+	name := memoryRegistryKeyName(hive, path)
+	for keyName := range registry.keys {
+		if keyName == name || strings.HasPrefix(keyName, name+`\`) {
+			delete(registry.keys, keyName)
+		}
+	}
+}
+
+func (registry *MemoryRegistry) OpenKey(hive string, path string) (RegistryKey, error) {
+	key, found := registry.keys[memoryRegistryKeyName(hive, path)]
+	if !found {
+		return nil, ErrRegistryNotExist
+	}
+	return key, nil
+}
+
+func (key *MemoryRegistryKey) SetValue(name string, value RegistryValue) {
+	key.values[strings.ToLower(name)] = value
+	key.names[strings.ToLower(name)] = name
+}
+
+func (key *MemoryRegistryKey) DeleteValue(name string) {
+	delete(key.values, strings.ToLower(name))
+	delete(key.names, strings.ToLower(name))
+}
+
+// Returns names of values in the case they were set, sorted.
+func (key *MemoryRegistryKey) ValueNames() []string {
+	lowerNames := []string{}
+	for lowerName := range key.names {
+		lowerNames = append(lowerNames, lowerName)
+	}
+	sort.Strings(lowerNames)
+	names := []string{}
+	for _, lowerName := range lowerNames {
+		names = append(names, key.names[lowerName])
+	}
+	return names
+}
+
+// Copies all values of the other key, overriding existing values.
+func (key *MemoryRegistryKey) Merge(other *MemoryRegistryKey) {
+	for lowerName, value := range other.values {
+		key.SetValue(other.names[lowerName], value)
+	}
+}
+
+func (key *MemoryRegistryKey) GetValue(name string) (RegistryValue, error) {
+	value, found := key.values[strings.ToLower(name)]
+	if !found {
+		return RegistryValue{}, ErrRegistryNotExist
+	}
+	return value, nil
+}
+
+func (key *MemoryRegistryKey) GetIntegerValue(name string) (uint64, error) {
+	value, err := key.GetValue(name)
+	if err != nil {
+		return 0, err
+	}
+	if value.Type != REG_TYPE_DWORD && value.Type != REG_TYPE_QWORD {
+		return 0, ErrRegistryUnexpectedType
+	}
+	return value.Data.(uint64), nil
+}
+
+func (key *MemoryRegistryKey) GetStringValue(name string) (string, error) {
+	value, err := key.GetValue(name)
+	if err != nil {
+		return "", err
+	}
+	if value.Type != REG_TYPE_SZ && value.Type != REG_TYPE_EXPAND_SZ {
+		return "", ErrRegistryUnexpectedType
+	}
+	return value.Data.(string), nil
+}
+
+func (key *MemoryRegistryKey) GetStringsValue(name string) ([]string, error) {
+	value, err := key.GetValue(name)
+	if err != nil {
+		return nil, err
+	}
+	if value.Type != REG_TYPE_MULTI_SZ {
+		return nil, ErrRegistryUnexpectedType
+	}
+	return value.Data.([]string), nil
+}
+
+func (key *MemoryRegistryKey) ListPolicyValues() ([]PolicyValueInfo, error) {
+	infos := []PolicyValueInfo{}
+	for _, name := range key.ValueNames() {
+		value, _ := key.GetValue(name)
+		infos = append(infos, PolicyValueInfo{name, RegistryValueTypeName(value.Type), value.Data})
+	}
+	return infos, nil
+}
+
+func (key *MemoryRegistryKey) Close() error {
+	return nil
+}
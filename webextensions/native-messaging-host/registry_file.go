@@ -0,0 +1,260 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	REG_FILE_HEADER_V5 = "Windows Registry Editor Version 5.00"
+	REG_FILE_HEADER_V4 = "REGEDIT4"
+)
+
+// Loads a file exported by the Registry Editor, in UTF-16 with BOM (version
+// 5) or in UTF-8 (REGEDIT4).
+func LoadRegFile(path string) (*MemoryRegistry, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	contents, _, hostError := DecodeContents(buffer, "")
+	if hostError != nil {
+		return nil, hostError
+	}
+	registry := NewMemoryRegistry()
+	if err := LoadRegFileContents(registry, contents); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return registry, nil
+}
+
+func LoadRegFileContents(registry *MemoryRegistry, contents string) error {
+	lines := JoinRegFileLines(contents)
+	if len(lines) == 0 {
+		return fmt.Errorf("empty file")
+	}
+	header := strings.TrimSpace(lines[0].text)
+	if header != REG_FILE_HEADER_V5 && header != REG_FILE_HEADER_V4 {
+		return fmt.Errorf("line %d: unknown header: %s", lines[0].number, header)
+	}
+	unicodeStrings := header == REG_FILE_HEADER_V5
+
+	var currentKey *MemoryRegistryKey
+	for _, line := range lines[1:] {
+		text := strings.TrimSpace(line.text)
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			keyPath := text[1 : len(text)-1]
+			deletion := strings.HasPrefix(keyPath, "-")
+			keyPath = strings.TrimPrefix(keyPath, "-")
+			hive, path, _ := strings.Cut(keyPath, `\`)
+			if deletion {
+				registry.DeleteKey(hive, path)
+				currentKey = nil
+			} else {
+				currentKey = registry.CreateKey(hive, path)
+			}
+			continue
+		}
+		if currentKey == nil {
+			return fmt.Errorf("line %d: value out of any key", line.number)
+		}
+		name, rawData, err := SplitRegFileValue(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line.number, err.Error())
+		}
+		if rawData == "-" {
+			currentKey.DeleteValue(name)
+			continue
+		}
+		value, err := ParseRegFileData(rawData, unicodeStrings)
+		if err != nil {
+			return fmt.Errorf("line %d: %s: %s", line.number, name, err.Error())
+		}
+		currentKey.SetValue(name, value)
+	}
+	return nil
+}
+
+type regFileLine struct {
+	number int
+	text   string
+}
+
+// Joins lines continued with a trailing backslash.
+func JoinRegFileLines(contents string) []regFileLine {
+	lines := []regFileLine{}
+	var continued *regFileLine
+	for index, text := range strings.Split(strings.ReplaceAll(contents, "\r\n", "\n"), "\n") {
+		if continued != nil {
+			continued.text += strings.TrimSpace(text)
+		} else {
+			lines = append(lines, regFileLine{index + 1, text})
+			continued = &lines[len(lines)-1]
+		}
+		if strings.HasSuffix(continued.text, `\`) && IsRegFileHexContinuation(continued.text) {
+			continued.text = strings.TrimSuffix(continued.text, `\`)
+		} else {
+			continued = nil
+		}
+	}
+	return lines
+}
+
+// Only hex data can be continued to the next line.
+func IsRegFileHexContinuation(text string) bool {
+	_, data, found := strings.Cut(text, "=")
+	return found && strings.HasPrefix(strings.TrimSpace(data), "hex")
+}
+
+func UnquoteRegFileString(text string) (unquoted string, rest string, err error) {
+	if !strings.HasPrefix(text, `"`) {
+		return "", "", fmt.Errorf("not a quoted string: %s", text)
+	}
+	var builder strings.Builder
+	for position := 1; position < len(text); position++ {
+		switch text[position] {
+		case '\\':
+			if position+1 < len(text) {
+				position++
+			}
+			builder.WriteByte(text[position])
+		case '"':
+			return builder.String(), text[position+1:], nil
+		default:
+			builder.WriteByte(text[position])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string: %s", text)
+}
+
+func SplitRegFileValue(text string) (name string, rawData string, err error) {
+	var rest string
+	if strings.HasPrefix(text, "@") {
+		name, rest = "", text[1:]
+	} else {
+		name, rest, err = UnquoteRegFileString(text)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", fmt.Errorf("missing \"=\" after %q", name)
+	}
+	return name, strings.TrimSpace(rest[1:]), nil
+}
+
+func ParseRegFileData(rawData string, unicodeStrings bool) (RegistryValue, error) {
+	switch {
+	case strings.HasPrefix(rawData, `"`):
+		data, rest, err := UnquoteRegFileString(rawData)
+		if err != nil {
+			return RegistryValue{}, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return RegistryValue{}, fmt.Errorf("extra characters after string: %s", rest)
+		}
+		return RegistryValue{REG_TYPE_SZ, data}, nil
+	case strings.HasPrefix(rawData, "dword:"):
+		data, err := strconv.ParseUint(strings.TrimPrefix(rawData, "dword:"), 16, 32)
+		if err != nil {
+			return RegistryValue{}, err
+		}
+		return RegistryValue{REG_TYPE_DWORD, data}, nil
+	case strings.HasPrefix(rawData, "hex"):
+		return ParseRegFileHexData(rawData, unicodeStrings)
+	}
+	return RegistryValue{}, fmt.Errorf("unknown data: %s", rawData)
+}
+
+func ParseRegFileHexData(rawData string, unicodeStrings bool) (RegistryValue, error) {
+	typeName, hexData, found := strings.Cut(rawData, ":")
+	if !found {
+		return RegistryValue{}, fmt.Errorf("invalid hex data: %s", rawData)
+	}
+	valueType := uint64(REG_TYPE_BINARY)
+	if typeName != "hex" {
+		if !strings.HasPrefix(typeName, "hex(") || !strings.HasSuffix(typeName, ")") {
+			return RegistryValue{}, fmt.Errorf("invalid hex data: %s", rawData)
+		}
+		parsedType, err := strconv.ParseUint(typeName[4:len(typeName)-1], 16, 32)
+		if err != nil {
+			return RegistryValue{}, err
+		}
+		valueType = parsedType
+	}
+
+	bytes := []byte{}
+	for _, hexByte := range strings.Split(hexData, ",") {
+		hexByte = strings.TrimSpace(hexByte)
+		if hexByte == "" {
+			continue
+		}
+		decoded, err := hex.DecodeString(hexByte)
+		if err != nil || len(decoded) != 1 {
+			return RegistryValue{}, fmt.Errorf("invalid hex byte: %s", hexByte)
+		}
+		bytes = append(bytes, decoded[0])
+	}
+
+	switch valueType {
+	case REG_TYPE_SZ, REG_TYPE_EXPAND_SZ:
+		decoded := DecodeRegFileStrings(bytes, unicodeStrings)
+		data := ""
+		if len(decoded) > 0 {
+			data = decoded[0]
+		}
+		return RegistryValue{uint32(valueType), data}, nil
+	case REG_TYPE_MULTI_SZ:
+		return RegistryValue{REG_TYPE_MULTI_SZ, DecodeRegFileStrings(bytes, unicodeStrings)}, nil
+	case REG_TYPE_DWORD, REG_TYPE_QWORD:
+		var data uint64
+		for index := len(bytes) - 1; index >= 0; index-- {
+			data = data<<8 | uint64(bytes[index])
+		}
+		return RegistryValue{uint32(valueType), data}, nil
+	}
+	return RegistryValue{uint32(valueType), bytes}, nil
+}
+
+// Decodes NUL separated strings, like RegQueryValueEx does.
+func DecodeRegFileStrings(bytes []byte, unicodeStrings bool) []string {
+	var units []uint16
+	if unicodeStrings {
+		for index := 0; index+1 < len(bytes); index += 2 {
+			units = append(units, uint16(bytes[index])|uint16(bytes[index+1])<<8)
+		}
+	} else {
+		for _, char := range []rune(string(bytes)) {
+			units = append(units, utf16.Encode([]rune{char})...)
+		}
+	}
+	if len(units) > 0 && units[len(units)-1] == 0 {
+		units = units[:len(units)-1]
+	}
+	decoded := []string{}
+	from := 0
+	for index, unit := range units {
+		if unit == 0 {
+			decoded = append(decoded, string(utf16.Decode(units[from:index])))
+			from = index + 1
+		}
+	}
+	if from < len(units) {
+		decoded = append(decoded, string(utf16.Decode(units[from:])))
+	}
+	return decoded
+}
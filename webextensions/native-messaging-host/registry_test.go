@@ -0,0 +1,201 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	registry := NewMemoryRegistry()
+	key := registry.CreateKey("HKEY_LOCAL_MACHINE", `SOFTWARE\Example`)
+	key.SetValue("Integer", RegistryValue{REG_TYPE_DWORD, uint64(1)})
+	key.SetValue("String", RegistryValue{REG_TYPE_SZ, "text"})
+	key.SetValue("Strings", RegistryValue{REG_TYPE_MULTI_SZ, []string{"a", "b"}})
+
+	opened, err := registry.OpenKey(REGISTRY_HIVE_LOCAL_MACHINE, `software\example\`)
+	assert.Nil(t, err)
+	integer, err := opened.GetIntegerValue("integer")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), integer)
+	text, err := opened.GetStringValue("String")
+	assert.Nil(t, err)
+	assert.Equal(t, "text", text)
+	texts, err := opened.GetStringsValue("Strings")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, texts)
+
+	_, err = opened.GetIntegerValue("String")
+	assert.Equal(t, ErrRegistryUnexpectedType, err)
+	_, err = opened.GetStringsValue("String")
+	assert.Equal(t, ErrRegistryUnexpectedType, err)
+	_, err = opened.GetStringValue("Missing")
+	assert.Equal(t, ErrRegistryNotExist, err)
+
+	_, err = registry.OpenKey(REGISTRY_HIVE_CURRENT_USER, `SOFTWARE\Example`)
+	assert.Equal(t, ErrRegistryNotExist, err)
+}
+
+func TestLoadRegFile_ManagedStorageExample(t *testing.T) {
+	registry, err := LoadRegFile(filepath.Join("..", "managed-storage-examples", "local-machine.reg"))
+	assert.Nil(t, err)
+
+	key, err := registry.OpenKey(REGISTRY_HIVE_LOCAL_MACHINE,
+		`SOFTWARE\Policies\Mozilla\Thunderbird\3rdparty\Extensions\flexible-confirm-mail@clear-code.com`)
+	assert.Nil(t, err)
+
+	minCount, err := key.GetIntegerValue("minConfirmMultipleRecipientDomainsCount")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), minCount)
+	internalDomains, err := key.GetStringsValue("internalDomains")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, internalDomains)
+	topMessage, err := key.GetStringValue("topMessage")
+	assert.Nil(t, err)
+	assert.Equal(t, "", topMessage)
+	fields, err := key.GetStringsValue("confirmDialogFields")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"internals", "externals", "subject", "body", "attachments"}, fields)
+}
+
+func TestLoadRegFileContents(t *testing.T) {
+	registry := NewMemoryRegistry()
+	err := LoadRegFileContents(registry, "REGEDIT4\r\n"+
+		"\r\n"+
+		"; comment\r\n"+
+		"[HKEY_CURRENT_USER\\Software\\Example]\r\n"+
+		"@=\"default\"\r\n"+
+		"\"Path\"=\"C:\\\\Program Files\\\\\"\r\n"+
+		"\"Expand\"=hex(2):25,54,45,4d,50,25,00\r\n"+
+		"\"Quad\"=hex(b):00,01,00,00,00,00,00,00\r\n"+
+		"\"Removed\"=dword:00000001\r\n"+
+		"\"Removed\"=-\r\n"+
+		"[HKEY_CURRENT_USER\\Software\\Example\\Sub]\r\n"+
+		"[-HKEY_CURRENT_USER\\Software\\Example\\Sub]\r\n")
+	assert.Nil(t, err)
+
+	key, err := registry.OpenKey(REGISTRY_HIVE_CURRENT_USER, `Software\Example`)
+	assert.Nil(t, err)
+	defaultValue, _ := key.GetStringValue("")
+	assert.Equal(t, "default", defaultValue)
+	path, _ := key.GetStringValue("Path")
+	assert.Equal(t, `C:\Program Files\`, path)
+	expand, _ := key.GetStringValue("Expand")
+	assert.Equal(t, "%TEMP%", expand)
+	quad, _ := key.GetIntegerValue("Quad")
+	assert.Equal(t, uint64(256), quad)
+	_, err = key.GetIntegerValue("Removed")
+	assert.Equal(t, ErrRegistryNotExist, err)
+	_, err = registry.OpenKey(REGISTRY_HIVE_CURRENT_USER, `Software\Example\Sub`)
+	assert.Equal(t, ErrRegistryNotExist, err)
+}
+
+func TestLoadRegFileContents_Errors(t *testing.T) {
+	cases := []struct {
+		contents string
+		message  string
+	}{
+		{"", "line 1: unknown header: "},
+		{"REGEDIT4\n\"Name\"=dword:1\n", "line 2: value out of any key"},
+		{"REGEDIT4\n[HKEY_CURRENT_USER\\Example]\n\"Name\"=dword:xyz\n", `line 3: Name: strconv.ParseUint: parsing "xyz": invalid syntax`},
+		{"REGEDIT4\n[HKEY_CURRENT_USER\\Example]\n\"Name\"=unknown\n", "line 3: Name: unknown data: unknown"},
+		{"REGEDIT4\n[HKEY_CURRENT_USER\\Example]\n\"Name\n", "line 3: unterminated string: \"Name"},
+	}
+	for _, c := range cases {
+		err := LoadRegFileContents(NewMemoryRegistry(), c.contents)
+		if assert.NotNil(t, err, c.contents) {
+			assert.Equal(t, c.message, err.Error(), c.contents)
+		}
+	}
+}
+
+func TestReadRegistryPolicies(t *testing.T) {
+	registry, err := LoadRegFile(filepath.Join("testdata", "policies.reg"))
+	assert.Nil(t, err)
+
+	response := ReadRegistryPolicies(registry)
+
+	assert.Equal(t, TbStyleConfigs{
+		"ShowCountdown":        true,
+		"CountdownSeconds":     uint64(10),
+		"FixedInternalDomains": []string{"example.com", "example.org"},
+		"TopMessage":           `Check "all" recipients`,
+		"UserRules": []interface{}{
+			map[string]interface{}{"id": "rule-1", "itemsLocal": []interface{}{"secret"}},
+		},
+	}, response.Default)
+	assert.Equal(t, map[string]string{
+		"ShowCountdown":        "HKLM",
+		"CountdownSeconds":     "HKCU",
+		"FixedInternalDomains": "HKLM",
+		"TopMessage":           "HKLM",
+		"UserRules":            "HKCU",
+	}, response.DefaultSources)
+
+	assert.Equal(t, TbStyleConfigs{
+		"ConfirmMultipleRecipientDomains":         true,
+		"MinConfirmMultipleRecipientDomainsCount": uint64(2),
+		"BuiltInAttentionTermsItems":              []string{"社外秘"},
+		"CountdownAllowSkip":                      false,
+	}, response.Locked)
+	assert.Equal(t, "HKLM", response.LockedSources["MinConfirmMultipleRecipientDomainsCount"])
+	assert.Equal(t, "HKCU", response.LockedSources["CountdownAllowSkip"])
+}
+
+func TestReadRegistryPolicies_Empty(t *testing.T) {
+	response := ReadRegistryPolicies(NewMemoryRegistry())
+	assert.Equal(t, TbStyleConfigs{}, response.Default)
+	assert.Equal(t, TbStyleConfigs{}, response.Locked)
+	assert.Empty(t, response.Problems)
+}
+
+type UnreadableRegistry struct{}
+
+func (registry UnreadableRegistry) OpenKey(hive string, path string) (RegistryKey, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestReadRegistryPolicies_Unreadable(t *testing.T) {
+	response := ReadRegistryPolicies(UnreadableRegistry{})
+	assert.Equal(t, TbStyleConfigs{}, response.Default)
+	assert.Len(t, response.Problems, 4)
+	assert.Equal(t, `Failed to open key HKLM\`+REGISTRY_POLICY_KEY_PATH+`\Default: access denied`, response.Problems[0])
+}
+
+func TestReadRegistryAccessPolicy(t *testing.T) {
+	registry := NewMemoryRegistry()
+	policy, err := ReadRegistryAccessPolicy(registry)
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	key := registry.CreateKey(REGISTRY_HIVE_LOCAL_MACHINE, REGISTRY_ACCESS_POLICY_KEY_PATH)
+	policy, err = ReadRegistryAccessPolicy(registry)
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	key.SetValue("AllowedDirectories", RegistryValue{REG_TYPE_MULTI_SZ, []string{`C:\Lists`}})
+	key.SetValue("AllowedExtensions", RegistryValue{REG_TYPE_MULTI_SZ, []string{"txt"}})
+	policy, err = ReadRegistryAccessPolicy(registry)
+	assert.NoError(t, err)
+	assert.Equal(t, &AccessPolicy{Directories: []string{`C:\Lists`}, Extensions: []string{"txt"}}, policy)
+}
+
+func TestReadRegistryAccessPolicy_WrongType(t *testing.T) {
+	registry := NewMemoryRegistry()
+	err := LoadRegFileContents(registry, "REGEDIT4\r\n"+
+		"\r\n"+
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Policies\FlexConfirmMail\NativeMessagingHost]`+"\r\n"+
+		`"AllowedDirectories"="C:\\Lists"`+"\r\n")
+	assert.NoError(t, err)
+
+	policy, err := ReadRegistryAccessPolicy(registry)
+	assert.Nil(t, policy)
+	assert.EqualError(t, err, "AllowedDirectories: unexpected key value type")
+}
@@ -0,0 +1,197 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type PolicyValueReport struct {
+	Source    string      `json:"source"`
+	Section   string      `json:"section"` // "Default" or "Locked"
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Value     interface{} `json:"value"`
+	ConfigKey string      `json:"configKey,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type ValidatePolicyResponse struct {
+	ResponseMeta
+	Values     []PolicyValueReport `json:"values"`
+	Problems   []string            `json:"problems"`
+	ErrorCount int                 `json:"errorCount"`
+}
+
+func (response *ValidatePolicyResponse) PrintForCLI(output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SOURCE\tSECTION\tNAME\tTYPE\tVALUE\tSTATUS")
+	for _, report := range response.Values {
+		status := "ok"
+		if report.Error != "" {
+			status = "error: " + report.Error
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", report.Source, report.Section, report.Name, report.Type, FormatPolicyValueForCLI(report.Value), status)
+	}
+	writer.Flush()
+	for _, problem := range response.Problems {
+		fmt.Fprintln(output, "error: "+problem)
+	}
+	if response.ErrorCount > 0 {
+		return fmt.Errorf("%d error(s) in policies", response.ErrorCount)
+	}
+	return nil
+}
+
+func FormatPolicyValueForCLI(value interface{}) string {
+	if bytes, isBytes := value.([]byte); isBytes {
+		return fmt.Sprintf("% x", bytes)
+	}
+	serialized, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(serialized)
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:    "validate-policy",
+		Help:    "check policy values in all sources, and report type mismatches, unknown names and out-of-range numbers",
+		Handler: HandleValidatePolicy,
+	})
+}
+
+func HandleValidatePolicy(request *Request) (Response, error) {
+	sources := OpenPolicySources()
+	defer sources.Close()
+	return ValidatePolicySources(sources), nil
+}
+
+func ValidatePolicySources(sources *PolicySources) *ValidatePolicyResponse {
+	response := &ValidatePolicyResponse{
+		Values:   []PolicyValueReport{},
+		Problems: append([]string{}, sources.Problems...),
+	}
+	allSources := append([]*PolicySource{}, sources.System...)
+	if sources.User != nil {
+		allSources = append(allSources, sources.User)
+	}
+	for _, source := range allSources {
+		for _, section := range []struct {
+			name   string
+			values PolicyValues
+		}{
+			{"Default", source.Default},
+			{"Locked", source.Locked},
+		} {
+			if section.values == nil {
+				continue
+			}
+			listable, isListable := section.values.(ListablePolicyValues)
+			if !isListable {
+				response.Problems = append(response.Problems, fmt.Sprintf("%s (%s): cannot list values", source.Name, section.name))
+				continue
+			}
+			infos, err := listable.ListPolicyValues()
+			if err != nil {
+				response.Problems = append(response.Problems, fmt.Sprintf("%s (%s): %s", source.Name, section.name, err.Error()))
+				continue
+			}
+			for _, info := range infos {
+				report := ValidatePolicyValue(section.values, info)
+				report.Source = source.Name
+				report.Section = section.name
+				response.Values = append(response.Values, report)
+				if report.Error != "" {
+					response.ErrorCount++
+				}
+			}
+		}
+	}
+	response.ErrorCount += len(response.Problems)
+	return response
+}
+
+func FindPolicyMapping(name string) *PolicyMapping {
+	for index, mapping := range PolicyMappings {
+		if strings.EqualFold(mapping.Name, name) {
+			return &PolicyMappings[index]
+		}
+	}
+	return nil
+}
+
+func ValidatePolicyValue(values PolicyValues, info PolicyValueInfo) PolicyValueReport {
+	report := PolicyValueReport{Name: info.Name, Type: info.Type, Value: info.Data}
+	mapping := FindPolicyMapping(info.Name)
+	if mapping == nil {
+		report.Error = "unknown value name"
+		return report
+	}
+	report.ConfigKey = mapping.ConfigKey
+
+	if IsNegativeNumber(info.Data) && (mapping.Type == POLICY_TYPE_BOOL || mapping.Type == POLICY_TYPE_INTEGER) {
+		report.Error = "out of range: negative number"
+		return report
+	}
+	if _, err := GetPolicyValue(values, info.Name, mapping.Type); err != nil {
+		report.Error = fmt.Sprintf("type mismatch: %s is expected (%s)", mapping.Type, err.Error())
+		return report
+	}
+	// Values in some sources are case-sensitive.
+	if _, err := GetPolicyValue(values, mapping.Name, mapping.Type); err != nil {
+		report.Error = "unknown value name, did you mean " + mapping.Name + "?"
+		return report
+	}
+
+	switch mapping.Type {
+	case POLICY_TYPE_BOOL:
+		if data, _ := values.GetIntegerValue(info.Name); data > 1 {
+			report.Error = fmt.Sprintf("out of range: %d is not 0 or 1", data)
+		}
+	case POLICY_TYPE_INTEGER:
+		valueRange, found := PolicyIntegerRanges[mapping.ConfigKey]
+		if !found {
+			break
+		}
+		data, _ := values.GetIntegerValue(info.Name)
+		if !valueRange.Contains(data) {
+			report.Error = fmt.Sprintf("out of range: %d is not in %d-%d", data, valueRange.Min, valueRange.Max)
+			if data > 0x7FFFFFFF && data <= 0xFFFFFFFF {
+				report.Error += fmt.Sprintf(" (%d as a signed DWORD)", int32(uint32(data)))
+			}
+		}
+	}
+	return report
+}
+
+func (valueRange PolicyIntegerRange) Contains(data uint64) bool {
+	if data >= valueRange.Min && data <= valueRange.Max {
+		return true
+	}
+	for _, extra := range valueRange.Extra {
+		if data == extra {
+			return true
+		}
+	}
+	return false
+}
+
+func IsNegativeNumber(data interface{}) bool {
+	switch number := data.(type) {
+	case float64:
+		return number < 0
+	case int64:
+		return number < 0
+	}
+	return false
+}
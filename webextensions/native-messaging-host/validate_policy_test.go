@@ -0,0 +1,91 @@
+/*
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePolicySources_Registry(t *testing.T) {
+	registry, err := LoadRegFile(filepath.Join("testdata", "policies.reg"))
+	assert.Nil(t, err)
+	key := registry.CreateKey(REGISTRY_HIVE_CURRENT_USER, REGISTRY_POLICY_KEY_PATH+`\Default`)
+	key.SetValue("countseconds", RegistryValue{REG_TYPE_DWORD, uint64(0xFFFFFFFF)})
+	key.SetValue("CountEnabled", RegistryValue{REG_TYPE_DWORD, uint64(2)})
+	key.SetValue("UnknownName", RegistryValue{REG_TYPE_SZ, "value"})
+
+	sources := OpenRegistryPolicySources(registry)
+	defer sources.Close()
+	response := ValidatePolicySources(sources)
+
+	errors := map[string]string{}
+	for _, report := range response.Values {
+		if report.Error != "" {
+			errors[report.Source+" "+report.Section+" "+report.Name] = report.Error
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"HKLM Default ConfirmationMode": "type mismatch: integer is expected (unexpected key value type)",
+		"HKCU Default CountEnabled":     "out of range: 2 is not 0 or 1",
+		"HKCU Default countseconds":     "out of range: 4294967295 is not in 0-2147483647 (-1 as a signed DWORD)",
+		"HKCU Default UnknownName":      "unknown value name",
+	}, errors)
+	assert.Equal(t, 4, response.ErrorCount)
+	assert.Equal(t, PolicyValueReport{
+		Source:    "HKLM",
+		Section:   "Locked",
+		Name:      "SafeBccThreshold",
+		Type:      "REG_QWORD",
+		Value:     uint64(2),
+		ConfigKey: "MinConfirmMultipleRecipientDomainsCount",
+	}, response.Values[6])
+}
+
+func TestValidatePolicySources_JSON(t *testing.T) {
+	dir := t.TempDir()
+	WritePolicyFile(t, filepath.Join(dir, "10-valid.json"), `{"Default":{"CountdownSeconds":5,"ShowCountdown":true,"UserRules":"[]"}}`)
+	WritePolicyFile(t, filepath.Join(dir, "20-invalid.json"), `{"Locked":{"CountSeconds":-1,"countdownAllowSkip":false,"UserRules":"[","TopMessage":3}}`)
+	WritePolicyFile(t, filepath.Join(dir, "30-broken.json"), `{`)
+
+	response := ValidatePolicySources(OpenJSONPolicySources(dir, ""))
+
+	errors := map[string]string{}
+	for _, report := range response.Values {
+		if report.Error != "" {
+			errors[report.Name] = report.Error
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"CountSeconds":       "out of range: negative number",
+		"countdownAllowSkip": "unknown value name, did you mean CountdownAllowSkip?",
+		"TopMessage":         "type mismatch: string is expected (TopMessage: not a string: 3)",
+		"UserRules":          "type mismatch: json is expected (UserRules: invalid JSON: unexpected end of JSON input)",
+	}, errors)
+	assert.Equal(t, 1, len(response.Problems))
+	assert.Equal(t, 5, response.ErrorCount)
+	assert.Equal(t, "number", response.Values[0].Type)
+
+	var output bytes.Buffer
+	err := response.PrintForCLI(&output)
+	assert.EqualError(t, err, "5 error(s) in policies")
+	assert.Contains(t, output.String(), "SOURCE")
+	assert.Contains(t, output.String(), "error: out of range: negative number")
+}
+
+func TestValidatePolicySources_NoError(t *testing.T) {
+	dir := t.TempDir()
+	WritePolicyFile(t, filepath.Join(dir, "policies.json"), `{"Default":{"AttentionDomainsConfirmationMode":20,"ConfirmDialogFields":["subject"]}}`)
+
+	response := ValidatePolicySources(OpenJSONPolicySources(dir, ""))
+	assert.Equal(t, 0, response.ErrorCount)
+
+	var output bytes.Buffer
+	assert.NoError(t, response.PrintForCLI(&output))
+}